@@ -0,0 +1,144 @@
+package adaptor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/application/service"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+)
+
+// OIDCHandler OpenID Connect 提供方的 HTTP 端点，路径以 OIDCConf.Issuer 中的路径为前缀
+func (s *StsServerImpl) OIDCHandler() http.Handler {
+	prefix := ""
+	if u, err := url.Parse(s.OIDCConf.Issuer); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/.well-known/openid-configuration", s.oidcDiscovery)
+	mux.HandleFunc(prefix+"/jwks", s.oidcJWKS)
+	mux.HandleFunc(prefix+"/authorize", s.oidcAuthorize)
+	mux.HandleFunc(prefix+"/token", s.oidcToken)
+	mux.HandleFunc(prefix+"/userinfo", s.oidcUserInfo)
+	return mux
+}
+
+func (s *StsServerImpl) oidcDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.OIDCService.Discovery())
+}
+
+func (s *StsServerImpl) oidcJWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.OIDCService.JWKS()
+	if err != nil {
+		writeOIDCError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(keys)
+}
+
+// 登录页可以通过 Authorization 头或 POST 表单中的 access_token 携带访问令牌，授权确认页的用户选择只接受 POST 表单
+func (s *StsServerImpl) oidcAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &service.OIDCError{Code: "invalid_request", Description: "malformed request"})
+		return
+	}
+	accessToken, consent := bearerToken(r), ""
+	if r.Method == http.MethodPost {
+		if accessToken == "" {
+			accessToken = r.PostForm.Get("access_token")
+		}
+		consent = r.PostForm.Get("consent")
+	}
+	location, err := s.OIDCService.Authorize(r.Context(), &service.AuthorizeReq{
+		ClientId:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		ResponseType:        r.Form.Get("response_type"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		Prompt:              r.Form.Get("prompt"),
+		AccessToken:         accessToken,
+		Consent:             consent,
+	})
+	if err != nil {
+		writeOIDCError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+func (s *StsServerImpl) oidcToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, &service.OIDCError{Code: "invalid_request", Description: "POST is required"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &service.OIDCError{Code: "invalid_request", Description: "malformed request"})
+		return
+	}
+	clientId, clientSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	// Basic 认证中的客户端id与密钥先经过表单编码，见 RFC 6749 2.3.1
+	if id, secret, ok := r.BasicAuth(); ok {
+		clientId, _ = url.QueryUnescape(id)
+		clientSecret, _ = url.QueryUnescape(secret)
+	}
+	resp, err := s.OIDCService.Token(r.Context(), &service.OIDCTokenReq{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err != nil {
+		writeOIDCError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *StsServerImpl) oidcUserInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := s.OIDCService.UserInfo(r.Context(), bearerToken(r))
+	if err != nil {
+		writeOIDCError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// writeOIDCError 按规范返回客户端错误，其他错误只记录日志
+func writeOIDCError(w http.ResponseWriter, r *http.Request, err error) {
+	oe := new(service.OIDCError)
+	if !errors.As(err, &oe) {
+		log.CtxError(r.Context(), "OIDC 请求处理失败[%v], path=%s", err, r.URL.Path)
+		writeJSON(w, http.StatusInternalServerError, &service.OIDCError{Code: "server_error"})
+		return
+	}
+	if oe.Status == http.StatusUnauthorized && oe.Code == "invalid_token" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	writeJSON(w, oe.Status, oe)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -9,9 +9,13 @@ import (
 
 type StsServerImpl struct {
 	*config.Config
-	AuthService   service.AuthService
-	CosService    service.CosService
-	FilterService service.FilterService
+	AuthService    service.AuthService
+	CosService     service.CosService
+	FilterService  service.FilterService
+	TokenService   service.TokenService
+	SessionService service.SessionService
+	AccountService service.AccountService
+	OIDCService    service.OIDCService
 }
 
 func (s *StsServerImpl) ReplaceContent(ctx context.Context, req *sts.ReplaceContentReq) (res *sts.ReplaceContentResp, err error) {
@@ -57,3 +61,103 @@ func (s *StsServerImpl) CheckEmail(ctx context.Context, req *sts.CheckEmailReq)
 func (s *StsServerImpl) CreateAuth(ctx context.Context, req *sts.CreateAuthReq) (res *sts.CreateAuthResp, err error) {
 	return s.AuthService.CreateAuth(ctx, req)
 }
+
+func (s *StsServerImpl) UnlockUser(ctx context.Context, req *sts.UnlockUserReq) (res *sts.UnlockUserResp, err error) {
+	return s.AuthService.UnlockUser(ctx, req)
+}
+
+func (s *StsServerImpl) RefreshToken(ctx context.Context, req *sts.RefreshTokenReq) (res *sts.RefreshTokenResp, err error) {
+	return s.TokenService.RefreshToken(ctx, req)
+}
+
+func (s *StsServerImpl) RevokeToken(ctx context.Context, req *sts.RevokeTokenReq) (res *sts.RevokeTokenResp, err error) {
+	return s.TokenService.RevokeToken(ctx, req)
+}
+
+func (s *StsServerImpl) GetJWKS(ctx context.Context, req *sts.GetJWKSReq) (res *sts.GetJWKSResp, err error) {
+	return s.TokenService.GetJWKS(ctx, req)
+}
+
+func (s *StsServerImpl) IntrospectToken(ctx context.Context, req *sts.IntrospectTokenReq) (res *sts.IntrospectTokenResp, err error) {
+	return s.TokenService.IntrospectToken(ctx, req)
+}
+
+func (s *StsServerImpl) RevokeUserTokens(ctx context.Context, req *sts.RevokeUserTokensReq) (res *sts.RevokeUserTokensResp, err error) {
+	return s.TokenService.RevokeUserTokens(ctx, req)
+}
+
+func (s *StsServerImpl) ListSessions(ctx context.Context, req *sts.ListSessionsReq) (res *sts.ListSessionsResp, err error) {
+	return s.SessionService.ListSessions(ctx, req)
+}
+
+func (s *StsServerImpl) RevokeSession(ctx context.Context, req *sts.RevokeSessionReq) (res *sts.RevokeSessionResp, err error) {
+	return s.SessionService.RevokeSession(ctx, req)
+}
+
+func (s *StsServerImpl) RevokeOtherSessions(ctx context.Context, req *sts.RevokeOtherSessionsReq) (res *sts.RevokeOtherSessionsResp, err error) {
+	return s.SessionService.RevokeOtherSessions(ctx, req)
+}
+
+func (s *StsServerImpl) EnrollTOTP(ctx context.Context, req *sts.EnrollTOTPReq) (res *sts.EnrollTOTPResp, err error) {
+	return s.AuthService.EnrollTOTP(ctx, req)
+}
+
+func (s *StsServerImpl) ConfirmTOTP(ctx context.Context, req *sts.ConfirmTOTPReq) (res *sts.ConfirmTOTPResp, err error) {
+	return s.AuthService.ConfirmTOTP(ctx, req)
+}
+
+func (s *StsServerImpl) VerifySecondFactor(ctx context.Context, req *sts.VerifySecondFactorReq) (res *sts.LoginResp, err error) {
+	return s.AuthService.VerifySecondFactor(ctx, req)
+}
+
+func (s *StsServerImpl) BeginPasskeyRegistration(ctx context.Context, req *sts.BeginPasskeyRegistrationReq) (res *sts.BeginPasskeyRegistrationResp, err error) {
+	return s.AuthService.BeginPasskeyRegistration(ctx, req)
+}
+
+func (s *StsServerImpl) FinishPasskeyRegistration(ctx context.Context, req *sts.FinishPasskeyRegistrationReq) (res *sts.FinishPasskeyRegistrationResp, err error) {
+	return s.AuthService.FinishPasskeyRegistration(ctx, req)
+}
+
+func (s *StsServerImpl) BeginPasskeyLogin(ctx context.Context, req *sts.BeginPasskeyLoginReq) (res *sts.BeginPasskeyLoginResp, err error) {
+	return s.AuthService.BeginPasskeyLogin(ctx, req)
+}
+
+func (s *StsServerImpl) FinishPasskeyLogin(ctx context.Context, req *sts.FinishPasskeyLoginReq) (res *sts.LoginResp, err error) {
+	return s.AuthService.FinishPasskeyLogin(ctx, req)
+}
+
+func (s *StsServerImpl) EmailLogin(ctx context.Context, req *sts.EmailLoginReq) (res *sts.LoginResp, err error) {
+	return s.AuthService.EmailLogin(ctx, req)
+}
+
+func (s *StsServerImpl) SetUserStatus(ctx context.Context, req *sts.SetUserStatusReq) (res *sts.SetUserStatusResp, err error) {
+	return s.AccountService.SetUserStatus(ctx, req)
+}
+
+func (s *StsServerImpl) ListUserAudits(ctx context.Context, req *sts.ListUserAuditsReq) (res *sts.ListUserAuditsResp, err error) {
+	return s.AccountService.ListUserAudits(ctx, req)
+}
+
+func (s *StsServerImpl) ListAuths(ctx context.Context, req *sts.ListAuthsReq) (res *sts.ListAuthsResp, err error) {
+	return s.AuthService.ListAuths(ctx, req)
+}
+
+func (s *StsServerImpl) RemoveAuth(ctx context.Context, req *sts.RemoveAuthReq) (res *sts.RemoveAuthResp, err error) {
+	return s.AuthService.RemoveAuth(ctx, req)
+}
+
+func (s *StsServerImpl) OAuthLogin(ctx context.Context, req *sts.OAuthLoginReq) (res *sts.LoginResp, err error) {
+	return s.AuthService.OAuthLogin(ctx, req)
+}
+
+func (s *StsServerImpl) MergeUsers(ctx context.Context, req *sts.MergeUsersReq) (res *sts.MergeUsersResp, err error) {
+	return s.AccountService.MergeUsers(ctx, req)
+}
+
+func (s *StsServerImpl) ChangeEmail(ctx context.Context, req *sts.ChangeEmailReq) (res *sts.ChangeEmailResp, err error) {
+	return s.AuthService.ChangeEmail(ctx, req)
+}
+
+func (s *StsServerImpl) RevertEmailChange(ctx context.Context, req *sts.RevertEmailChangeReq) (res *sts.RevertEmailChangeResp, err error) {
+	return s.AuthService.RevertEmailChange(ctx, req)
+}
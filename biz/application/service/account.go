@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	auditmapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/audit"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/google/wire"
+	"github.com/samber/lo"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+type IAccountService interface {
+	SetUserStatus(ctx context.Context, req *gensts.SetUserStatusReq) (resp *gensts.SetUserStatusResp, err error)
+	ListUserAudits(ctx context.Context, req *gensts.ListUserAuditsReq) (resp *gensts.ListUserAuditsResp, err error)
+	MergeUsers(ctx context.Context, req *gensts.MergeUsersReq) (resp *gensts.MergeUsersResp, err error)
+}
+
+type AccountService struct {
+	Config           *config.Config
+	Redis            *redis.Redis
+	UserMongoMapper  usermapper.IUserMongoMapper
+	AuditMongoMapper auditmapper.IAuditMongoMapper
+	TokenManager     *token.Manager
+}
+
+var AccountSet = wire.NewSet(
+	wire.Struct(new(AccountService), "*"),
+	wire.Bind(new(IAccountService), new(*AccountService)),
+)
+
+// 管理员修改账号状态，非正常状态会立即吊销用户的全部令牌
+// 每次修改都必须记录审计日志，记录失败时恢复原状态并返回错误
+func (s *AccountService) SetUserStatus(ctx context.Context, req *gensts.SetUserStatusReq) (resp *gensts.SetUserStatusResp, err error) {
+	resp = new(gensts.SetUserStatusResp)
+	switch req.Status {
+	case consts.StatusActive, consts.StatusDisabled, consts.StatusBanned, consts.StatusPendingVerification:
+	default:
+		return resp, consts.ErrInvalidStatus
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+
+	status := &usermapper.Status{
+		State:      req.Status,
+		Reason:     req.Reason,
+		OperatorId: req.OperatorId,
+	}
+	if req.Status == consts.StatusBanned && req.BannedUntil > 0 {
+		status.Until = time.Unix(req.BannedUntil, 0)
+	}
+	if err = s.UserMongoMapper.SetStatus(ctx, req.UserId, status); err != nil {
+		return resp, err
+	}
+	if _, err = s.AuditMongoMapper.Insert(ctx, &auditmapper.AuditLog{
+		UserId:     req.UserId,
+		Action:     auditmapper.ActionSetStatus,
+		OperatorId: req.OperatorId,
+		Reason:     req.Reason,
+		Before:     user.Status,
+		After:      status,
+	}); err != nil {
+		if e := s.UserMongoMapper.SetStatus(ctx, req.UserId, user.Status); e != nil {
+			log.CtxError(ctx, "记录审计日志失败后恢复账号状态失败[%v], userId=%s", e, req.UserId)
+		}
+		return resp, err
+	}
+	if req.Status != consts.StatusActive {
+		if err = s.TokenManager.RevokeUser(ctx, req.UserId); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// 分页查询用户的审计记录
+func (s *AccountService) ListUserAudits(ctx context.Context, req *gensts.ListUserAuditsReq) (resp *gensts.ListUserAuditsResp, err error) {
+	resp = new(gensts.ListUserAuditsResp)
+	logs, total, err := s.AuditMongoMapper.FindByUser(ctx, req.UserId, req.Skip, req.Limit)
+	if err != nil {
+		return resp, err
+	}
+	resp.Total = total
+	resp.Audits = lo.Map(logs, func(l *auditmapper.AuditLog, _ int) *gensts.UserAudit {
+		audit := &gensts.UserAudit{
+			Action:     l.Action,
+			OperatorId: l.OperatorId,
+			Reason:     l.Reason,
+			CreateTime: l.CreateAt.Unix(),
+		}
+		if l.Before != nil {
+			audit.StatusBefore = l.Before.State
+		}
+		if l.After != nil {
+			audit.StatusAfter = l.After.State
+		}
+		return audit
+	})
+	return resp, nil
+}
+
+// UserMergedEvent 账号合并事件，MergedId 的数据应迁移到 SurvivorId
+type UserMergedEvent struct {
+	SurvivorId string `json:"survivorId"`
+	MergedId   string `json:"mergedId"`
+	MergeTime  int64  `json:"mergeTime"`
+}
+
+// 合并同一个人的两个用户，调用方需同时持有两个用户登录后的访问令牌以证明控制两个账号
+//   - 被合并用户的登录方式与通行密钥移动到存活用户，密码、两步验证与角色以存活用户为准
+//   - 被合并用户标记为已合并，全部令牌被吊销，之后无法登录
+//   - 审计记录写入失败时撤销合并并返回错误
+//   - 合并事件推送到 UserMergedEvents 队列，由其他服务迁移数据
+func (s *AccountService) MergeUsers(ctx context.Context, req *gensts.MergeUsersReq) (resp *gensts.MergeUsersResp, err error) {
+	resp = new(gensts.MergeUsersResp)
+	survivor, err := s.tokenOwner(ctx, req.SurvivorToken)
+	if err != nil {
+		return resp, err
+	}
+	merged, err := s.tokenOwner(ctx, req.MergedToken)
+	if err != nil {
+		return resp, err
+	}
+	if survivor.ID == merged.ID {
+		return resp, consts.ErrMergeSelf
+	}
+	// 受限的账号不能通过合并绕过停用或封禁
+	if err = checkUserStatus(survivor); err != nil {
+		return resp, err
+	}
+	if err = checkUserStatus(merged); err != nil {
+		return resp, err
+	}
+
+	survivorId, mergedId := survivor.ID.Hex(), merged.ID.Hex()
+	before, err := s.UserMongoMapper.Merge(ctx, survivorId, mergedId)
+	if err != nil {
+		return resp, err
+	}
+	if _, err = s.AuditMongoMapper.Insert(ctx, &auditmapper.AuditLog{
+		UserId:     mergedId,
+		Action:     auditmapper.ActionMerge,
+		OperatorId: survivorId,
+		Reason:     "合并到用户 " + survivorId,
+	}); err != nil {
+		if e := s.UserMongoMapper.Unmerge(ctx, survivorId, before); e != nil {
+			log.CtxError(ctx, "记录审计日志失败后撤销合并失败[%v], survivorId=%s, mergedId=%s", e, survivorId, mergedId)
+		}
+		return resp, err
+	}
+	resp.UserId = survivorId
+	if err = s.TokenManager.RevokeUser(ctx, mergedId); err != nil {
+		log.CtxError(ctx, "吊销被合并用户的令牌失败[%v], userId=%s", err, mergedId)
+	}
+	event, _ := json.Marshal(&UserMergedEvent{
+		SurvivorId: survivorId,
+		MergedId:   mergedId,
+		MergeTime:  time.Now().Unix(),
+	})
+	// 合并已经完成，事件推送失败只记录日志，可据此人工补发
+	if _, err = s.Redis.LpushCtx(ctx, consts.UserMergedEvents, string(event)); err != nil {
+		log.CtxError(ctx, "推送账号合并事件失败[%v], event=%s", err, event)
+	}
+	return resp, nil
+}
+
+// 只接受登录签发的访问令牌，返回令牌所属的用户
+func (s *AccountService) tokenOwner(ctx context.Context, accessToken string) (*usermapper.User, error) {
+	claims, active, err := s.TokenManager.Introspect(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, consts.ErrInvalidToken
+	}
+	return s.UserMongoMapper.FindOne(ctx, claims.Subject)
+}
+
+// 检查账号状态是否允许登录、修改密码与刷新令牌
+func checkUserStatus(user *usermapper.User) error {
+	if user.Merge != nil {
+		return consts.ErrAccountMerged
+	}
+	if user.Status == nil {
+		return nil
+	}
+	switch user.Status.State {
+	case consts.StatusDisabled:
+		return consts.ErrAccountDisabled
+	case consts.StatusBanned:
+		if user.Status.Until.IsZero() {
+			return consts.ErrAccountBanned
+		}
+		// 封禁到期后自动恢复，无需再次修改状态
+		if wait := time.Until(user.Status.Until); wait > 0 {
+			return consts.RetryAfter(consts.ErrAccountBanned, wait)
+		}
+	case consts.StatusPendingVerification:
+		return consts.ErrAccountPending
+	}
+	return nil
+}
@@ -6,11 +6,26 @@ import (
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
 	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/cipher"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/email"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/limiter"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/lockout"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/oauth"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/password"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/ticket"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/totp"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/verifycode"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/webauthn"
 	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
 	"github.com/google/wire"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"github.com/zeromicro/go-zero/core/stores/redis"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"net/url"
+	"time"
 )
 
 type AuthService interface {
@@ -20,6 +35,20 @@ type AuthService interface {
 	SendEmail(ctx context.Context, req *gensts.SendEmailReq) (resp *gensts.SendEmailResp, err error)
 	Login(ctx context.Context, req *gensts.LoginReq) (resp *gensts.LoginResp, err error)
 	AppendAuth(ctx context.Context, req *gensts.AppendAuthReq) (resp *gensts.AppendAuthResp, err error)
+	UnlockUser(ctx context.Context, req *gensts.UnlockUserReq) (resp *gensts.UnlockUserResp, err error)
+	EnrollTOTP(ctx context.Context, req *gensts.EnrollTOTPReq) (resp *gensts.EnrollTOTPResp, err error)
+	ConfirmTOTP(ctx context.Context, req *gensts.ConfirmTOTPReq) (resp *gensts.ConfirmTOTPResp, err error)
+	VerifySecondFactor(ctx context.Context, req *gensts.VerifySecondFactorReq) (resp *gensts.LoginResp, err error)
+	BeginPasskeyRegistration(ctx context.Context, req *gensts.BeginPasskeyRegistrationReq) (resp *gensts.BeginPasskeyRegistrationResp, err error)
+	FinishPasskeyRegistration(ctx context.Context, req *gensts.FinishPasskeyRegistrationReq) (resp *gensts.FinishPasskeyRegistrationResp, err error)
+	BeginPasskeyLogin(ctx context.Context, req *gensts.BeginPasskeyLoginReq) (resp *gensts.BeginPasskeyLoginResp, err error)
+	FinishPasskeyLogin(ctx context.Context, req *gensts.FinishPasskeyLoginReq) (resp *gensts.LoginResp, err error)
+	EmailLogin(ctx context.Context, req *gensts.EmailLoginReq) (resp *gensts.LoginResp, err error)
+	ListAuths(ctx context.Context, req *gensts.ListAuthsReq) (resp *gensts.ListAuthsResp, err error)
+	RemoveAuth(ctx context.Context, req *gensts.RemoveAuthReq) (resp *gensts.RemoveAuthResp, err error)
+	OAuthLogin(ctx context.Context, req *gensts.OAuthLoginReq) (resp *gensts.LoginResp, err error)
+	ChangeEmail(ctx context.Context, req *gensts.ChangeEmailReq) (resp *gensts.ChangeEmailResp, err error)
+	RevertEmailChange(ctx context.Context, req *gensts.RevertEmailChangeReq) (resp *gensts.RevertEmailChangeResp, err error)
 }
 
 var AuthSet = wire.NewSet(
@@ -31,25 +60,182 @@ type AuthServiceImpl struct {
 	Config          *config.Config
 	Redis           *redis.Redis
 	UserMongoMapper usermapper.IUserMongoMapper
+	PasswordHasher  *password.Hasher
+	PasswordPolicy  *password.Policy
+	Lockout         *lockout.Lockout
+	EmailLimiter    *limiter.EmailLimiter
+	CodeStore       *verifycode.Store
+	CodeGenerator   *verifycode.Generator
+	TicketStore     *ticket.Store
+	TokenManager    *token.Manager
+	Cipher          *cipher.Cipher
+	TOTP            *totp.TOTP
+	WebAuthn        *webauthn.WebAuthn
+	OAuth           *oauth.Registry
+}
+
+// EmailTicket 邮箱验证通过后签发的一次性凭证内容，登录链接中的 Code 为同一封邮件中的验证码
+type EmailTicket struct {
+	Email   string `json:"email"`
+	Purpose int64  `json:"purpose"`
+	Code    string `json:"code,omitempty"`
 }
 
 // 添加登录方式
 func (s *AuthServiceImpl) AppendAuth(ctx context.Context, req *gensts.AppendAuthReq) (resp *gensts.AppendAuthResp, err error) {
 	resp = new(gensts.AppendAuthResp)
-	if err = s.UserMongoMapper.AppendAuth(ctx, req.UserId, &usermapper.Auth{
+	// 通行密钥只能通过注册仪式添加
+	if req.AuthType == consts.PasskeyAuthType {
+		return resp, consts.ErrAuthNotSupported
+	}
+	auth := &usermapper.Auth{
 		Type:       req.AuthType,
 		AppId:      req.AppId,
 		UnionId:    req.UnionId,
 		PlatformId: req.PlatFormId,
-	}); err != nil {
+	}
+	if req.AuthType == consts.EmailAuthType {
+		if err = s.peekEmailTicket(ctx, req.Ticket, consts.PurposeBindAccount, req.AppId); err != nil {
+			return resp, err
+		}
+		// 邮箱已被其他账号绑定时不消费凭证
+		if _, err = s.UserMongoMapper.FindOneByAuth(ctx, auth); err == nil {
+			return resp, consts.ErrHaveExist
+		} else if !errors.Is(err, consts.ErrNotFound) {
+			return resp, err
+		}
+		if err = s.consumeEmailTicket(ctx, req.Ticket, consts.PurposeBindAccount, req.AppId); err != nil {
+			return resp, err
+		}
+	}
+	// 已配置提供方的登录方式不信任调用方传入的身份，以授权码交换的结果为准
+	if provider, ok := s.OAuth.ByAuthType(req.AuthType); ok {
+		if auth, err = s.exchangeOAuthCode(ctx, provider, req.Code, req.RedirectUri); err != nil {
+			return resp, err
+		}
+	}
+	if err = s.UserMongoMapper.AppendAuth(ctx, req.UserId, auth); err != nil {
 		return resp, err
 	}
 	return resp, nil
 }
 
+// 列出用户绑定的登录方式
+func (s *AuthServiceImpl) ListAuths(ctx context.Context, req *gensts.ListAuthsReq) (resp *gensts.ListAuthsResp, err error) {
+	resp = new(gensts.ListAuthsResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	resp.Auths = lo.Map(user.Auths, func(auth *usermapper.Auth, _ int) *gensts.Auth {
+		return &gensts.Auth{
+			AuthType:   auth.Type,
+			AppId:      auth.AppId,
+			UnionId:    auth.UnionId,
+			PlatFormId: auth.PlatformId,
+		}
+	})
+	return resp, nil
+}
+
+// 解绑登录方式，不能解绑最后一个登录方式
+// 需要重新验证身份，以下方式任选其一：用户任一绑定邮箱的解绑验证凭证、密码、两步验证码、通行密钥断言
+// 先确认登录方式属于该用户再验证身份，避免无效请求消耗验证凭证
+func (s *AuthServiceImpl) RemoveAuth(ctx context.Context, req *gensts.RemoveAuthReq) (resp *gensts.RemoveAuthResp, err error) {
+	resp = new(gensts.RemoveAuthResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	auth := &usermapper.Auth{
+		Type:       req.AuthType,
+		AppId:      req.AppId,
+		UnionId:    req.UnionId,
+		PlatformId: req.PlatFormId,
+	}
+	if _, ok := lo.Find(user.Auths, func(a *usermapper.Auth) bool {
+		return *a == *auth
+	}); !ok {
+		return resp, consts.ErrNotFound
+	}
+	if len(user.Auths) < 2 {
+		return resp, consts.ErrLastAuth
+	}
+	if err = s.reauthenticate(ctx, user, req); err != nil {
+		return resp, err
+	}
+
+	if err = s.UserMongoMapper.RemoveAuth(ctx, req.UserId, auth); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 敏感操作前重新验证身份，按邮箱验证凭证、密码、两步验证码、通行密钥的顺序使用请求中提供的第一种方式
+func (s *AuthServiceImpl) reauthenticate(ctx context.Context, user *usermapper.User, req *gensts.RemoveAuthReq) error {
+	switch {
+	case req.Ticket != "":
+		// 先校验用途与邮箱再消费，其他用途的凭证不会因此作废
+		t := new(EmailTicket)
+		if err := s.TicketStore.Peek(ctx, consts.EmailTicket, req.Ticket, t); err != nil {
+			if errors.Is(err, consts.ErrInvalidTicket) {
+				return consts.ErrNotPassEmailCheck
+			}
+			return err
+		}
+		if t.Purpose != consts.PurposeUnbindAccount || !userEmailBound(user, t.Email) {
+			return consts.ErrNotPassEmailCheck
+		}
+		return s.consumeEmailTicket(ctx, req.Ticket, consts.PurposeUnbindAccount, t.Email)
+	case req.Password != "":
+		return s.checkPasswordWithLockout(ctx, user, req.Password, lockout.UserKey(user.ID.Hex()))
+	case req.TotpCode != "":
+		return s.checkTOTPWithLockout(ctx, user, req.TotpCode)
+	case len(req.ClientDataJson) > 0:
+		challenge, err := s.WebAuthn.Challenge(req.ClientDataJson)
+		if err != nil {
+			return consts.ErrPasskeyInvalid
+		}
+		if err = s.TicketStore.Consume(ctx, consts.PasskeyLogin, challenge, new(PasskeyCeremony)); err != nil {
+			return err
+		}
+		return s.checkPasskeyAssertion(ctx, user, challenge, req.CredentialId, req.ClientDataJson, req.AuthenticatorData, req.Signature)
+	default:
+		return consts.ErrReauthRequired
+	}
+}
+
+// 用户是否绑定了该邮箱
+func userEmailBound(user *usermapper.User, email string) bool {
+	_, ok := lo.Find(user.Auths, func(auth *usermapper.Auth) bool {
+		return auth.Type == consts.EmailAuthType && auth.AppId == email
+	})
+	return ok
+}
+
 // 通过某个登录方式登录
+//
+// 错误约定：
+//   - 密码登录方式下账号不存在、未设置密码与密码错误均返回 ErrPasswordNotEqual，且都执行一次密码哈希，无法据此枚举已注册的邮箱
+//   - 未配置提供方的第三方登录方式由调用方完成身份校验，账号不存在时返回 ErrUserNotFound，调用方可据此引导注册
+//   - 已配置提供方的登录方式返回 ErrAuthNotSupported，需要通过 OAuthLogin 使用授权码登录
+//   - 失败次数过多返回 ErrAccountLocked，账号被停用返回 ErrAccountDisabled
+//   - 开启两步验证时不返回错误，resp.SecondFactorRequired 为 true 并携带挑战凭证
 func (s *AuthServiceImpl) Login(ctx context.Context, req *gensts.LoginReq) (resp *gensts.LoginResp, err error) {
 	resp = new(gensts.LoginResp)
+	// 通行密钥需要校验断言签名，只能通过 FinishPasskeyLogin 登录
+	if req.AuthType == consts.PasskeyAuthType {
+		return resp, consts.ErrAuthNotSupported
+	}
+	if _, ok := s.OAuth.ByAuthType(req.AuthType); ok {
+		return resp, consts.ErrAuthNotSupported
+	}
+	lockKeys := []string{lockout.AuthKey(req.AuthType, req.AppId, req.UnionId, req.PlatFormId)}
+	if isPasswordAuthType(req.AuthType) {
+		if err = s.checkLocked(ctx, lockKeys...); err != nil {
+			return resp, err
+		}
+	}
 	user, err := s.UserMongoMapper.FindOneByAuth(ctx, &usermapper.Auth{
 		Type:       req.AuthType,
 		AppId:      req.AppId,
@@ -57,36 +243,99 @@ func (s *AuthServiceImpl) Login(ctx context.Context, req *gensts.LoginReq) (resp
 		PlatformId: req.PlatFormId,
 	})
 	if errors.Is(err, consts.ErrNotFound) {
-		return resp, nil
+		if !isPasswordAuthType(req.AuthType) {
+			return resp, consts.ErrUserNotFound
+		}
+		s.PasswordHasher.VerifyDummy(req.Password)
+		return resp, s.loginFailed(ctx, lockKeys...)
 	}
 	if err != nil {
 		return resp, err
 	}
 
-	if req.Password == "" {
-		req.Password = consts.DefaultPassword
+	if !isPasswordAuthType(req.AuthType) {
+		// 第三方登录方式由调用方完成身份校验，不使用密码，已哈希的旧默认密码在使用密码登录或修改密码时清除
+		return s.completeLogin(ctx, user, loginDevice(req), resp)
+	}
+
+	if req.Password == consts.LegacyDefaultPassword {
+		if err = s.clearLegacyPassword(ctx, user); err != nil {
+			return resp, err
+		}
 	}
-	if user.PassWord != req.Password {
-		return resp, consts.ErrPasswordNotEqual
+	lockKeys = append(lockKeys, lockout.UserKey(user.ID.Hex()))
+	if user.PassWord == "" {
+		s.PasswordHasher.VerifyDummy(req.Password)
+		return resp, s.loginFailed(ctx, lockKeys...)
 	}
+	if err = s.checkPasswordWithLockout(ctx, user, req.Password, lockKeys...); err != nil {
+		return resp, err
+	}
+
+	return s.completeLogin(ctx, user, loginDevice(req), resp)
+}
 
+func loginDevice(req *gensts.LoginReq) *token.Device {
+	return &token.Device{
+		DeviceName: req.DeviceName,
+		UserAgent:  req.UserAgent,
+		Ip:         req.Ip,
+		AuthType:   req.AuthType,
+	}
+}
+
+// 第一步校验通过后，开启两步验证的用户先返回挑战凭证，否则直接签发令牌
+func (s *AuthServiceImpl) completeLogin(ctx context.Context, user *usermapper.User, device *token.Device, resp *gensts.LoginResp) (*gensts.LoginResp, error) {
+	if err := checkUserStatus(user); err != nil {
+		return resp, err
+	}
+	if user.TOTP != nil && user.TOTP.Enabled {
+		challenge, err := s.TicketStore.Issue(ctx, consts.LoginChallenge, &LoginChallenge{
+			UserId: user.ID.Hex(),
+			Device: device,
+		}, s.Config.TOTPConf.ChallengeTTL)
+		if err != nil {
+			return resp, err
+		}
+		resp.UserId = user.ID.Hex()
+		resp.SecondFactorRequired = true
+		resp.ChallengeToken = challenge
+		return resp, nil
+	}
+	return s.issueLoginTokens(ctx, user, device, resp)
+}
+
+// 登录成功后签发访问令牌与刷新令牌
+func (s *AuthServiceImpl) issueLoginTokens(ctx context.Context, user *usermapper.User, device *token.Device, resp *gensts.LoginResp) (*gensts.LoginResp, error) {
+	pair, err := s.TokenManager.Issue(ctx, user.ID.Hex(), user.Role, device)
+	if err != nil {
+		return resp, err
+	}
 	resp.UserId = user.ID.Hex()
+	resp.AccessToken = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	resp.SessionId = pair.SessionId
 	return resp, nil
 }
 
 func (s *AuthServiceImpl) CheckEmail(ctx context.Context, req *gensts.CheckEmailReq) (resp *gensts.CheckEmailResp, err error) {
 	resp = new(gensts.CheckEmailResp)
-	code, err := s.Redis.GetCtx(ctx, fmt.Sprintf("%s:%s", consts.EmailCode, req.Email))
-	if err != nil {
+	if _, ok := consts.PurposeNames[req.Purpose]; !ok {
+		return resp, consts.ErrInvalidPurpose
+	}
+	if err = s.CodeStore.Verify(ctx, emailCodeKey(req.Purpose, req.Email), req.Code); err != nil {
 		return resp, err
 	}
 
-	if code != "" && code == req.Code {
-		if err = s.Redis.SetexCtx(ctx, fmt.Sprintf("%s:%s", consts.PassCheckEmail, req.Email), "true", 300); err != nil {
-			return resp, err
-		}
-		resp.Ok = true
+	resp.Ticket, err = s.TicketStore.Issue(ctx, consts.EmailTicket, &EmailTicket{
+		Email:   req.Email,
+		Purpose: req.Purpose,
+	}, s.Config.VerifyCodeConf.TicketTTL)
+	if err != nil {
+		return resp, err
 	}
+	resp.Ok = true
 	return resp, nil
 }
 
@@ -96,23 +345,23 @@ func (s *AuthServiceImpl) SetPassword(ctx context.Context, req *gensts.SetPasswo
 	var user *usermapper.User
 	switch o := req.Key.(type) {
 	case *gensts.SetPasswordReq_EmailOptions:
-		value := ""
-		if value, err = s.Redis.GetCtx(ctx, fmt.Sprintf("%s:%s", consts.PassCheckEmail, o.EmailOptions.Email)); err != nil {
+		if err = s.peekEmailTicket(ctx, o.EmailOptions.Ticket, consts.PurposeResetPassword, o.EmailOptions.Email); err != nil {
 			return resp, err
 		}
-		if value != "true" {
-			return resp, consts.ErrNotPassEmailCheck
-		}
 		user, err = s.UserMongoMapper.FindOneByAuth(ctx, &usermapper.Auth{Type: int64(consts.EmailAuthType), AppId: o.EmailOptions.Email})
 		if err != nil {
 			return resp, err
 		}
-		_, err = s.UserMongoMapper.Update(ctx, &usermapper.User{ID: user.ID, PassWord: req.Password})
-		if err != nil {
+		if err = checkUserStatus(user); err != nil {
 			return resp, err
 		}
-
-		if _, err = s.Redis.DelCtx(ctx, fmt.Sprintf("%s:%s", consts.PassCheckEmail, o.EmailOptions.Email)); err != nil {
+		if err = s.checkPasswordPolicy(ctx, user, req.Password, o.EmailOptions.Email); err != nil {
+			return resp, err
+		}
+		if err = s.consumeEmailTicket(ctx, o.EmailOptions.Ticket, consts.PurposeResetPassword, o.EmailOptions.Email); err != nil {
+			return resp, err
+		}
+		if err = s.savePassword(ctx, user, req.Password); err != nil {
 			return resp, err
 		}
 
@@ -121,11 +370,20 @@ func (s *AuthServiceImpl) SetPassword(ctx context.Context, req *gensts.SetPasswo
 		if err != nil {
 			return resp, err
 		}
-		if user.PassWord != o.UserIdOptions.Password {
-			return resp, consts.ErrPasswordNotEqual
+		if err = checkUserStatus(user); err != nil {
+			return resp, err
+		}
+		if err = s.clearLegacyPassword(ctx, user); err != nil {
+			return resp, err
+		}
+		// 未设置密码的用户首次设置密码时无需校验旧密码
+		if user.PassWord != "" {
+			if err = s.checkPasswordWithLockout(ctx, user, o.UserIdOptions.Password, lockout.UserKey(user.ID.Hex())); err != nil {
+				return resp, err
+			}
 		}
 
-		if _, err = s.UserMongoMapper.Update(ctx, &usermapper.User{ID: user.ID, PassWord: req.Password}); err != nil {
+		if err = s.changePassword(ctx, user, req.Password, userEmail(user)); err != nil {
 			return resp, err
 		}
 	}
@@ -135,46 +393,369 @@ func (s *AuthServiceImpl) SetPassword(ctx context.Context, req *gensts.SetPasswo
 // 发送邮件
 func (s *AuthServiceImpl) SendEmail(ctx context.Context, req *gensts.SendEmailReq) (resp *gensts.SendEmailResp, err error) {
 	resp = new(gensts.SendEmailResp)
-	code, err := email.SendEmail(ctx, s.Config.EmailConf, req.Email, req.Subject)
+	purpose, ok := consts.PurposeNames[req.Purpose]
+	if !ok {
+		return resp, consts.ErrInvalidPurpose
+	}
+	if err = s.EmailLimiter.Take(ctx, req.Email, req.Ip); err != nil {
+		return resp, err
+	}
+	code, err := s.CodeGenerator.Generate(purpose)
 	if err != nil {
 		return resp, err
 	}
-	if err = s.Redis.SetexCtx(ctx, fmt.Sprintf("%s:%s", consts.EmailCode, req.Email), code, 300); err != nil {
+	if err = s.CodeStore.Save(ctx, emailCodeKey(req.Purpose, req.Email), code); err != nil {
+		return resp, err
+	}
+	ttl := time.Duration(s.Config.VerifyCodeConf.TTL) * time.Second
+	if req.Purpose == consts.PurposeLogin && s.Config.EmailLoginConf.LinkURL != "" {
+		link, err := s.loginLink(ctx, req.Email, code)
+		if err != nil {
+			return resp, err
+		}
+		if err = email.SendLoginEmail(ctx, s.Config.EmailConf, req.Email, req.Subject, code, link, ttl); err != nil {
+			return resp, err
+		}
+		return resp, nil
+	}
+	if err = email.SendEmail(ctx, s.Config.EmailConf, req.Email, req.Subject, code, ttl); err != nil {
 		return resp, err
 	}
 	return resp, nil
 }
 
+// 签发一次性登录令牌并拼接登录链接，有效期与验证码相同，令牌与同一封邮件中的验证码绑定
+func (s *AuthServiceImpl) loginLink(ctx context.Context, email, code string) (string, error) {
+	link, err := url.Parse(s.Config.EmailLoginConf.LinkURL)
+	if err != nil {
+		return "", err
+	}
+	t, err := s.TicketStore.Issue(ctx, consts.EmailLoginLink, &EmailTicket{
+		Email:   email,
+		Purpose: consts.PurposeLogin,
+		Code:    code,
+	}, s.Config.VerifyCodeConf.TTL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", t)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// 邮箱免密登录，使用登录验证码或邮件中登录链接的令牌换取登录结果
+//   - 同一封邮件中的验证码与登录链接只能使用其中一个，使用链接时同时消费验证码，验证码被使用或重新发送后链接失效
+//   - 邮箱未注册时与验证码错误返回相同的 ErrCodeNotEqual，无法据此枚举已注册的邮箱
+func (s *AuthServiceImpl) EmailLogin(ctx context.Context, req *gensts.EmailLoginReq) (resp *gensts.LoginResp, err error) {
+	resp = new(gensts.LoginResp)
+	address, code := req.Email, req.Code
+	if req.Token != "" {
+		t := new(EmailTicket)
+		if err = s.TicketStore.Consume(ctx, consts.EmailLoginLink, req.Token, t); err != nil {
+			return resp, err
+		}
+		if t.Purpose != consts.PurposeLogin {
+			return resp, consts.ErrInvalidTicket
+		}
+		address, code = t.Email, t.Code
+	}
+	if err = s.CodeStore.Verify(ctx, emailCodeKey(consts.PurposeLogin, address), code); err != nil {
+		if req.Token != "" {
+			return resp, consts.ErrInvalidTicket
+		}
+		return resp, err
+	}
+
+	user, err := s.UserMongoMapper.FindOneByAuth(ctx, &usermapper.Auth{Type: consts.EmailAuthType, AppId: address})
+	if errors.Is(err, consts.ErrNotFound) {
+		return resp, consts.ErrCodeNotEqual
+	}
+	if err != nil {
+		return resp, err
+	}
+	return s.completeLogin(ctx, user, &token.Device{
+		DeviceName: req.DeviceName,
+		UserAgent:  req.UserAgent,
+		Ip:         req.Ip,
+		AuthType:   consts.EmailAuthType,
+	}, resp)
+}
+
 // 注册
 func (s *AuthServiceImpl) CreateAuth(ctx context.Context, req *gensts.CreateAuthReq) (resp *gensts.CreateAuthResp, err error) {
 	resp = new(gensts.CreateAuthResp)
+	// 通行密钥只能通过注册仪式添加，已配置提供方的登录方式通过 OAuthLogin 注册
+	if req.AuthType == consts.PasskeyAuthType {
+		return resp, consts.ErrAuthNotSupported
+	}
+	if _, ok := s.OAuth.ByAuthType(req.AuthType); ok {
+		return resp, consts.ErrAuthNotSupported
+	}
+	if req.AuthType == consts.EmailAuthType {
+		if err = s.peekEmailTicket(ctx, req.Ticket, consts.PurposeRegister, req.AppId); err != nil {
+			return resp, err
+		}
+	}
 	auth := &usermapper.Auth{
 		Type:       req.AuthType,
 		AppId:      req.AppId,
 		UnionId:    req.UnionId,
 		PlatformId: req.PlatFormId,
 	}
+	// 提前检查只为避免无谓的密码哈希，并发注册由授权信息的唯一索引保证只有一个成功
 	_, err = s.UserMongoMapper.FindOneByAuth(ctx, auth)
 	switch {
 	case err == nil:
-		return resp, consts.ErrHaveExist
+		return resp, authExistError(req.AuthType)
 	case errors.Is(err, consts.ErrNotFound):
 		break
 	default:
 		return resp, err
 	}
 
-	password := req.Password
-	if password == "" {
-		password = consts.DefaultPassword
+	// 未提供密码时不设置密码凭据，只能通过该登录方式本身登录
+	hash := ""
+	if req.Password != "" {
+		addr := ""
+		if req.AuthType == consts.EmailAuthType {
+			addr = req.AppId
+		}
+		if err = s.checkPasswordPolicy(ctx, nil, req.Password, addr); err != nil {
+			return resp, err
+		}
+		if hash, err = s.PasswordHasher.Hash(req.Password); err != nil {
+			return resp, err
+		}
+	}
+	if req.AuthType == consts.EmailAuthType {
+		if err = s.consumeEmailTicket(ctx, req.Ticket, consts.PurposeRegister, req.AppId); err != nil {
+			return resp, err
+		}
 	}
 	resp.UserId, err = s.UserMongoMapper.Insert(ctx, &usermapper.User{
-		PassWord: password,
+		PassWord: hash,
 		Role:     req.Role,
 		Auths:    []*usermapper.Auth{auth},
 	})
+	if errors.Is(err, consts.ErrAuthExist) {
+		return resp, authExistError(req.AuthType)
+	}
 	if err != nil {
 		return resp, err
 	}
 	return resp, nil
 }
+
+// 邮箱沿用原有的“邮箱已被注册”，其他登录方式返回通用的冲突错误
+func authExistError(authType int64) error {
+	if authType == consts.EmailAuthType {
+		return consts.ErrHaveExist
+	}
+	return consts.ErrAuthExist
+}
+
+// 解除账号因密码错误次数过多产生的锁定
+func (s *AuthServiceImpl) UnlockUser(ctx context.Context, req *gensts.UnlockUserReq) (resp *gensts.UnlockUserResp, err error) {
+	resp = new(gensts.UnlockUserResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	keys := []string{lockout.UserKey(req.UserId)}
+	for _, auth := range user.Auths {
+		keys = append(keys, lockout.AuthKey(auth.Type, auth.AppId, auth.UnionId, auth.PlatformId))
+	}
+	if err = s.Lockout.Unlock(ctx, keys...); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func emailCodeKey(purpose int64, email string) string {
+	return fmt.Sprintf("%s:%d:%s", consts.EmailCode, purpose, email)
+}
+
+// 消费邮箱验证凭证，凭证必须由同一邮箱、同一用途的验证签发，且只能使用一次
+func (s *AuthServiceImpl) consumeEmailTicket(ctx context.Context, token string, purpose int64, email string) error {
+	return checkEmailTicket(ctx, s.TicketStore.Consume, token, purpose, email)
+}
+
+// 校验邮箱验证凭证但不消费，凭证在其余校验通过、写入之前再消费，避免因其他错误作废凭证
+func (s *AuthServiceImpl) peekEmailTicket(ctx context.Context, token string, purpose int64, email string) error {
+	return checkEmailTicket(ctx, s.TicketStore.Peek, token, purpose, email)
+}
+
+func checkEmailTicket(ctx context.Context, read func(ctx context.Context, kind, token string, data any) error, token string, purpose int64, email string) error {
+	t := new(EmailTicket)
+	if err := read(ctx, consts.EmailTicket, token, t); err != nil {
+		if errors.Is(err, consts.ErrInvalidTicket) {
+			return consts.ErrNotPassEmailCheck
+		}
+		return err
+	}
+	if t.Purpose != purpose || t.Email != email {
+		return consts.ErrNotPassEmailCheck
+	}
+	return nil
+}
+
+// 是否为使用密码校验身份的登录方式
+func isPasswordAuthType(authType int64) bool {
+	return authType == consts.EmailAuthType
+}
+
+// 旧版本为未提供密码的用户写入了共享默认密码，将其迁移为未设置密码
+func (s *AuthServiceImpl) clearLegacyPassword(ctx context.Context, user *usermapper.User) error {
+	if user.PassWord == "" {
+		return nil
+	}
+	ok, _, err := s.PasswordHasher.Verify(consts.LegacyDefaultPassword, user.PassWord)
+	if err != nil || !ok {
+		return err
+	}
+	if err = s.UserMongoMapper.UnsetPassword(ctx, user.ID.Hex()); err != nil {
+		return err
+	}
+	user.PassWord = ""
+	return nil
+}
+
+// 校验密码，旧明文或参数过时的哈希在校验通过后按当前配置重新哈希
+func (s *AuthServiceImpl) checkPassword(ctx context.Context, user *usermapper.User, pwd string) error {
+	if user.PassWord == "" {
+		return consts.ErrPasswordNotSet
+	}
+	ok, rehash, err := s.PasswordHasher.Verify(pwd, user.PassWord)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return consts.ErrPasswordNotEqual
+	}
+	if rehash {
+		if err = s.updatePassword(ctx, user, pwd); err != nil {
+			log.CtxError(ctx, "重新哈希密码失败[%v], userId=%s", err, user.ID.Hex())
+		}
+	}
+	return nil
+}
+
+func (s *AuthServiceImpl) checkLocked(ctx context.Context, keys ...string) error {
+	wait, err := s.Lockout.Check(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return consts.RetryAfter(consts.ErrAccountLocked, wait)
+	}
+	return nil
+}
+
+// 校验密码并记录失败次数，达到阈值后锁定，校验通过时清除计数
+func (s *AuthServiceImpl) checkPasswordWithLockout(ctx context.Context, user *usermapper.User, pwd string, keys ...string) error {
+	if err := s.checkLocked(ctx, keys...); err != nil {
+		return err
+	}
+	err := s.checkPassword(ctx, user, pwd)
+	switch {
+	case err == nil:
+		if e := s.Lockout.Reset(ctx, keys...); e != nil {
+			log.CtxError(ctx, "清除登录失败计数失败[%v], userId=%s", e, user.ID.Hex())
+		}
+	case errors.Is(err, consts.ErrPasswordNotEqual):
+		return s.loginFailed(ctx, keys...)
+	}
+	return err
+}
+
+// 记录一次密码校验失败，达到上限时返回锁定错误，否则返回 ErrPasswordNotEqual
+func (s *AuthServiceImpl) loginFailed(ctx context.Context, keys ...string) error {
+	wait, err := s.Lockout.Fail(ctx, keys...)
+	if err != nil {
+		log.CtxError(ctx, "记录登录失败次数失败[%v], keys=%v", err, keys)
+	}
+	if wait > 0 {
+		return consts.RetryAfter(consts.ErrAccountLocked, wait)
+	}
+	return consts.ErrPasswordNotEqual
+}
+
+// 设置新密码，校验密码策略并将当前密码记入历史
+func (s *AuthServiceImpl) changePassword(ctx context.Context, user *usermapper.User, pwd, email string) error {
+	if err := s.checkPasswordPolicy(ctx, user, pwd, email); err != nil {
+		return err
+	}
+	return s.savePassword(ctx, user, pwd)
+}
+
+// 保存已通过密码策略校验的新密码，密码历史中只保存哈希，尚未迁移的明文旧密码先哈希再记入
+func (s *AuthServiceImpl) savePassword(ctx context.Context, user *usermapper.User, pwd string) error {
+	hash, err := s.PasswordHasher.Hash(pwd)
+	if err != nil {
+		return err
+	}
+	previous := user.PassWord
+	if previous != "" && password.IsPlaintext(previous) {
+		if previous, err = s.PasswordHasher.Hash(previous); err != nil {
+			return err
+		}
+	}
+	return s.UserMongoMapper.ChangePassword(ctx, user.ID.Hex(), hash, previous, s.PasswordPolicy.HistorySize()-1)
+}
+
+// 校验密码策略，未通过的规则全部列在错误详情中
+// 只有其他规则都通过时才与历史密码比较，避免为必然被拒绝的密码执行多次哈希
+func (s *AuthServiceImpl) checkPasswordPolicy(ctx context.Context, user *usermapper.User, pwd, email string) error {
+	violations := s.PasswordPolicy.Check(pwd, email)
+	if len(violations) == 0 && user != nil {
+		reused, err := s.reusedPassword(ctx, user, pwd)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, &password.Violation{Rule: password.RuleHistory, Description: "不能使用最近用过的密码"})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return consts.FieldViolations(consts.ErrWeakPassword, lo.Map(violations, func(v *password.Violation, _ int) *errdetails.BadRequest_FieldViolation {
+		return &errdetails.BadRequest_FieldViolation{Field: "password", Description: v.Rule + ": " + v.Description}
+	})...)
+}
+
+// 判断密码是否与当前密码或最近的历史密码相同，历史按时间顺序保存
+func (s *AuthServiceImpl) reusedPassword(ctx context.Context, user *usermapper.User, pwd string) (bool, error) {
+	n := s.PasswordPolicy.HistorySize()
+	if n <= 0 {
+		return false, nil
+	}
+	hashes := []string{user.PassWord}
+	for i := len(user.History) - 1; i >= 0 && len(hashes) < n; i-- {
+		hashes = append(hashes, user.History[i])
+	}
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		ok, _, err := s.PasswordHasher.Verify(pwd, hash)
+		if err != nil {
+			log.CtxError(ctx, "校验历史密码失败[%v], userId=%s", err, user.ID.Hex())
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *AuthServiceImpl) updatePassword(ctx context.Context, user *usermapper.User, pwd string) error {
+	hash, err := s.PasswordHasher.Hash(pwd)
+	if err != nil {
+		return err
+	}
+	_, err = s.UserMongoMapper.Update(ctx, &usermapper.User{ID: user.ID, PassWord: hash})
+	return err
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/oauth"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/ticket"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const workers = 16
+
+// 依赖本地 Mongo 与 Redis，通过 MONGO_URL 与 REDIS_ADDR 指定，未设置时跳过；每个测试使用独立的库并在结束时删除
+func newTestAuthService(t *testing.T) *AuthServiceImpl {
+	t.Helper()
+	url, addr := os.Getenv("MONGO_URL"), os.Getenv("REDIS_ADDR")
+	if url == "" || addr == "" {
+		t.Skip("MONGO_URL or REDIS_ADDR not set")
+	}
+	rc := redis.RedisConf{Host: addr, Type: redis.NodeType, NonBlock: true}
+	c := &config.Config{CacheConf: cache.CacheConf{{RedisConf: rc, Weight: 100}}}
+	c.Mongo.URL = url
+	c.Mongo.DB = fmt.Sprintf("sts_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx := context.Background()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+		if err != nil {
+			t.Logf("drop %s: %v", c.Mongo.DB, err)
+			return
+		}
+		defer client.Disconnect(ctx)
+		if err = client.Database(c.Mongo.DB).Drop(ctx); err != nil {
+			t.Logf("drop %s: %v", c.Mongo.DB, err)
+		}
+	})
+
+	mapper := usermapper.NewMongoMapper(c)
+	if err := mapper.EnsureAuthIndex(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := oauth.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AuthServiceImpl{
+		Config:          c,
+		UserMongoMapper: mapper,
+		TicketStore:     ticket.NewStore(redis.MustNewRedis(rc)),
+		OAuth:           registry,
+	}
+}
+
+// 并发注册同一登录方式时只有一个成功，其余调用方收到与顺序注册相同的错误
+func TestCreateAuthConcurrentSameAuth(t *testing.T) {
+	s := newTestAuthService(t)
+	ctx := context.Background()
+	cases := []struct {
+		name string
+		req  func(i int) *gensts.CreateAuthReq
+		want error
+	}{
+		{"email", func(i int) *gensts.CreateAuthReq {
+			email := "race@example.com"
+			// 每个请求使用各自的注册凭证，凭证只能使用一次
+			ticket, err := s.TicketStore.Issue(ctx, consts.EmailTicket, &EmailTicket{Email: email, Purpose: consts.PurposeRegister}, 60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &gensts.CreateAuthReq{AuthType: consts.EmailAuthType, AppId: email, Ticket: ticket}
+		}, consts.ErrHaveExist},
+		{"third party", func(int) *gensts.CreateAuthReq {
+			return &gensts.CreateAuthReq{AuthType: 2, AppId: "wx-app", UnionId: "race-union-id"}
+		}, consts.ErrAuthExist},
+	}
+	for _, c := range cases {
+		reqs := make([]*gensts.CreateAuthReq, workers)
+		for i := range reqs {
+			reqs[i] = c.req(i)
+		}
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			ok    int
+			errs  []error
+			start = make(chan struct{})
+		)
+		for _, req := range reqs {
+			wg.Add(1)
+			go func(req *gensts.CreateAuthReq) {
+				defer wg.Done()
+				<-start
+				_, err := s.CreateAuth(ctx, req)
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					ok++
+				} else {
+					errs = append(errs, err)
+				}
+			}(req)
+		}
+		close(start)
+		wg.Wait()
+		if ok != 1 {
+			t.Errorf("%s: %d registrations succeeded, want 1", c.name, ok)
+		}
+		for _, err := range errs {
+			if !errors.Is(err, c.want) {
+				t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/email"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// EmailRevert 撤销令牌对应的修改，OldEmail 为撤销期内第一次修改前的邮箱，ChangeAt 为第一次修改的时间，单位毫秒
+type EmailRevert struct {
+	UserId   string `json:"userId"`
+	OldEmail string `json:"oldEmail"`
+	NewEmail string `json:"newEmail"`
+	ChangeAt int64  `json:"changeAt"`
+}
+
+// 修改绑定邮箱
+//   - 需要新邮箱用途为修改邮箱的验证凭证，配置 RequireOldTicket 或携带 OldTicket 时同时校验旧邮箱
+//   - 修改后向撤销期内第一次修改前的邮箱发送通知，附带撤销令牌，通知发送失败不影响修改结果
+func (s *AuthServiceImpl) ChangeEmail(ctx context.Context, req *gensts.ChangeEmailReq) (resp *gensts.ChangeEmailResp, err error) {
+	resp = new(gensts.ChangeEmailResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if err = checkUserStatus(user); err != nil {
+		return resp, err
+	}
+	oldEmail := userEmail(user)
+	if oldEmail == "" {
+		return resp, consts.ErrEmailNotBound
+	}
+	if req.NewEmail == oldEmail {
+		return resp, nil
+	}
+	requireOld := s.Config.ChangeEmailConf.RequireOldTicket || req.OldTicket != ""
+	if requireOld {
+		if err = s.peekEmailTicket(ctx, req.OldTicket, consts.PurposeChangeEmail, oldEmail); err != nil {
+			return resp, err
+		}
+	}
+	if err = s.peekEmailTicket(ctx, req.NewTicket, consts.PurposeChangeEmail, req.NewEmail); err != nil {
+		return resp, err
+	}
+	_, err = s.UserMongoMapper.FindOneByAuth(ctx, &usermapper.Auth{Type: consts.EmailAuthType, AppId: req.NewEmail})
+	switch {
+	case err == nil:
+		return resp, consts.ErrHaveExist
+	case !errors.Is(err, consts.ErrNotFound):
+		return resp, err
+	}
+	if requireOld {
+		if err = s.consumeEmailTicket(ctx, req.OldTicket, consts.PurposeChangeEmail, oldEmail); err != nil {
+			return resp, err
+		}
+	}
+	if err = s.consumeEmailTicket(ctx, req.NewTicket, consts.PurposeChangeEmail, req.NewEmail); err != nil {
+		return resp, err
+	}
+
+	// 撤销期内再次修改时沿用第一次修改的记录，撤销令牌始终恢复到最初的邮箱，通知也始终发往最初的邮箱
+	change := &usermapper.EmailChange{
+		OldEmail: oldEmail,
+		NewEmail: req.NewEmail,
+	}
+	now := time.Now()
+	revert := user.Revert
+	if revert == nil || !revert.ExpireAt.After(now) {
+		revert = &usermapper.PendingRevert{
+			Email:    oldEmail,
+			Auths:    user.Auths,
+			ChangeAt: now,
+			ExpireAt: now.Add(time.Duration(s.Config.ChangeEmailConf.RevertTTL) * time.Second),
+		}
+		change.Revert = revert
+	}
+	if err = s.UserMongoMapper.ChangeEmail(ctx, req.UserId, change, s.Config.ChangeEmailConf.HistorySize); err != nil {
+		return resp, err
+	}
+	if err = s.notifyEmailChanged(ctx, &EmailRevert{
+		UserId:   req.UserId,
+		OldEmail: revert.Email,
+		NewEmail: req.NewEmail,
+		ChangeAt: revert.ChangeAt.UnixMilli(),
+	}, revert.ExpireAt); err != nil {
+		log.CtxError(ctx, "发送邮箱修改通知失败[%v], userId=%s", err, req.UserId)
+	}
+	return resp, nil
+}
+
+// 撤销邮箱修改，将账号恢复到撤销期内第一次修改前的状态，无论此后邮箱又被修改了几次
+//   - 恢复最初的邮箱，移除此后新增的授权信息与通行密钥，以及此后开启的两步验证
+//   - 清除密码并吊销全部令牌，修改邮箱的一方无法继续使用账号，用户需通过最初的邮箱重新设置密码
+//   - 撤销令牌在撤销完成后才消费，中途失败时可以重试
+func (s *AuthServiceImpl) RevertEmailChange(ctx context.Context, req *gensts.RevertEmailChangeReq) (resp *gensts.RevertEmailChangeResp, err error) {
+	resp = new(gensts.RevertEmailChangeResp)
+	r := new(EmailRevert)
+	if err = s.TicketStore.Peek(ctx, consts.EmailRevert, req.Token, r); err != nil {
+		return resp, err
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, r.UserId)
+	if err != nil {
+		return resp, err
+	}
+	// 撤销记录已被使用或已过期时令牌失效
+	revert := user.Revert
+	if revert == nil || revert.Email != r.OldEmail || revert.ChangeAt.UnixMilli() != r.ChangeAt || !revert.ExpireAt.After(time.Now()) {
+		return resp, consts.ErrInvalidTicket
+	}
+
+	// 合并账号后可能绑定多个邮箱，按撤销记录而不是当前的第一个邮箱判断：最初的邮箱仍绑定时无需恢复，
+	// 否则替换此后新增的邮箱，优先替换令牌对应的新邮箱，新增的邮箱已被解绑时重新绑定最初的邮箱
+	if !userEmailBound(user, revert.Email) {
+		added := lo.Filter(user.Auths, func(auth *usermapper.Auth, _ int) bool {
+			return auth.Type == consts.EmailAuthType && !lo.ContainsBy(revert.Auths, func(a *usermapper.Auth) bool { return *a == *auth })
+		})
+		current, ok := lo.Find(added, func(auth *usermapper.Auth) bool { return auth.AppId == r.NewEmail })
+		if !ok && len(added) > 0 {
+			current, ok = added[0], true
+		}
+		if ok {
+			err = s.UserMongoMapper.ChangeEmail(ctx, r.UserId, &usermapper.EmailChange{
+				OldEmail: current.AppId,
+				NewEmail: revert.Email,
+				Reverted: true,
+			}, s.Config.ChangeEmailConf.HistorySize)
+		} else {
+			err = s.UserMongoMapper.AppendAuth(ctx, r.UserId, &usermapper.Auth{Type: consts.EmailAuthType, AppId: revert.Email})
+		}
+		if err != nil {
+			return resp, err
+		}
+	}
+	if user, err = s.UserMongoMapper.FindOne(ctx, r.UserId); err != nil {
+		return resp, err
+	}
+	for _, auth := range user.Auths {
+		if lo.ContainsBy(revert.Auths, func(a *usermapper.Auth) bool { return *a == *auth }) {
+			continue
+		}
+		if err = s.UserMongoMapper.RemoveAuth(ctx, r.UserId, auth); err != nil {
+			return resp, err
+		}
+	}
+	unsetTOTP := user.TOTP != nil && (!user.TOTP.Enabled || user.TOTP.EnableAt.After(revert.ChangeAt))
+	if err = s.UserMongoMapper.FinishEmailRevert(ctx, r.UserId, unsetTOTP); err != nil {
+		return resp, err
+	}
+	if err = s.TokenManager.RevokeUser(ctx, r.UserId); err != nil {
+		return resp, err
+	}
+	// 撤销记录已清除，令牌即使未能消费也不能再次使用
+	if err = s.TicketStore.Consume(ctx, consts.EmailRevert, req.Token, new(EmailRevert)); err != nil {
+		log.CtxError(ctx, "消费撤销令牌失败[%v], userId=%s", err, r.UserId)
+	}
+	resp.UserId = r.UserId
+	resp.Email = revert.Email
+	return resp, nil
+}
+
+// 签发撤销令牌并通知最初的邮箱，令牌在撤销记录过期时同时过期，配置了撤销页时发送撤销链接
+func (s *AuthServiceImpl) notifyEmailChanged(ctx context.Context, r *EmailRevert, expireAt time.Time) error {
+	ttl := int(time.Until(expireAt).Seconds())
+	if ttl <= 0 {
+		return nil
+	}
+	t, err := s.TicketStore.Issue(ctx, consts.EmailRevert, r, ttl)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if s.Config.ChangeEmailConf.RevertURL != "" {
+		u, err := url.Parse(s.Config.ChangeEmailConf.RevertURL)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+		query.Set("token", t)
+		u.RawQuery = query.Encode()
+		link = u.String()
+	}
+	return email.SendEmailChangedEmail(ctx, s.Config.EmailConf, r.OldEmail, "绑定邮箱已修改", r.NewEmail, t, link)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/oauth"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/pkg/errors"
+)
+
+// 使用第三方授权码登录，账号不存在时自动注册，resp.IsNewUser 表示本次新建了用户
+func (s *AuthServiceImpl) OAuthLogin(ctx context.Context, req *gensts.OAuthLoginReq) (resp *gensts.LoginResp, err error) {
+	resp = new(gensts.LoginResp)
+	provider, ok := s.OAuth.Get(req.Provider)
+	if !ok {
+		return resp, consts.ErrProviderNotFound
+	}
+	auth, err := s.exchangeOAuthCode(ctx, provider, req.Code, req.RedirectUri)
+	if err != nil {
+		return resp, err
+	}
+
+	user, err := s.UserMongoMapper.FindOneByAuth(ctx, auth)
+	if errors.Is(err, consts.ErrNotFound) {
+		user = &usermapper.User{Auths: []*usermapper.Auth{auth}}
+		_, err = s.UserMongoMapper.Insert(ctx, user)
+		switch {
+		case err == nil:
+			resp.IsNewUser = true
+		case errors.Is(err, consts.ErrAuthExist):
+			// 同一身份并发登录时只有一个请求注册成功，其余请求使用已注册的用户
+			user, err = s.UserMongoMapper.FindOneByAuth(ctx, auth)
+		}
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	return s.completeLogin(ctx, user, &token.Device{
+		DeviceName: req.DeviceName,
+		UserAgent:  req.UserAgent,
+		Ip:         req.Ip,
+		AuthType:   provider.AuthType,
+	}, resp)
+}
+
+// 用授权码向提供方换取身份，提供方返回的错误不透出给调用方
+func (s *AuthServiceImpl) exchangeOAuthCode(ctx context.Context, provider *oauth.Provider, code, redirectURI string) (*usermapper.Auth, error) {
+	identity, err := provider.Exchange(ctx, code, redirectURI)
+	if err != nil {
+		log.CtxInfo(ctx, "第三方授权码交换失败[%v], provider=%s", err, provider.Name)
+		return nil, consts.ErrOAuthFailed
+	}
+	auth := &usermapper.Auth{
+		Type:    provider.AuthType,
+		AppId:   provider.AppId,
+		UnionId: identity.UnionId,
+	}
+	// 旧授权信息迁移后才能按新格式查找到已有用户，否则会为同一身份注册新用户
+	// 新旧授权信息分属不同用户时以新格式的用户为准，旧授权信息留待人工合并
+	switch err = s.UserMongoMapper.MigrateLegacyAuth(ctx, auth); {
+	case errors.Is(err, consts.ErrAuthBound):
+		log.CtxError(ctx, "旧授权信息与已有用户冲突, type=%d, unionId=%s", auth.Type, auth.UnionId)
+	case err != nil:
+		return nil, err
+	}
+	return auth, nil
+}
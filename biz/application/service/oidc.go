@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	clientmapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/client"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/jwt"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/keyring"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/password"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/ticket"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/google/wire"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	ScopeOpenId = "openid"
+	ScopeEmail  = "email"
+)
+
+// 授权确认页提交的用户选择
+const (
+	ConsentApprove = "approve"
+	ConsentDeny    = "deny"
+)
+
+type IOIDCService interface {
+	Discovery() map[string]any
+	JWKS() ([]byte, error)
+	Authorize(ctx context.Context, req *AuthorizeReq) (location string, err error)
+	Token(ctx context.Context, req *OIDCTokenReq) (resp *OIDCTokenResp, err error)
+	UserInfo(ctx context.Context, accessToken string) (info map[string]any, err error)
+}
+
+type OIDCService struct {
+	Config            *config.Config
+	UserMongoMapper   usermapper.IUserMongoMapper
+	ClientMongoMapper clientmapper.IClientMongoMapper
+	PasswordHasher    *password.Hasher
+	TicketStore       *ticket.Store
+	TokenManager      *token.Manager
+	Keyring           *keyring.Keyring
+}
+
+var OIDCSet = wire.NewSet(
+	wire.Struct(new(OIDCService), "*"),
+	wire.Bind(new(IOIDCService), new(*OIDCService)),
+)
+
+// OIDCError 按 RFC 6749 格式返回给客户端的错误
+type OIDCError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OIDCError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oidcError(status int, code, description string) *OIDCError {
+	return &OIDCError{Status: status, Code: code, Description: description}
+}
+
+// AuthorizeReq 授权端点的请求参数，AccessToken 为用户登录后持有的访问令牌，Consent 为授权确认页通过 POST 提交的用户选择
+type AuthorizeReq struct {
+	ClientId            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+	AccessToken         string
+	Consent             string
+}
+
+// AuthorizationCode 授权码对应的授权请求，RedirectURI 为请求中携带的原值，换取令牌时必须一致，Sid 为用户授权时的登录会话
+type AuthorizationCode struct {
+	ClientId      string `json:"clientId"`
+	RedirectURI   string `json:"redirectUri,omitempty"`
+	UserId        string `json:"userId"`
+	Sid           string `json:"sid,omitempty"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"codeChallenge"`
+}
+
+// OIDCTokenReq 令牌端点的请求参数，客户端密钥来自 Basic 认证或表单
+type OIDCTokenReq struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientId     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+type OIDCTokenResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IdToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// IdTokenClaims ID 令牌的载荷，sub 为用户id，sid 为本次签发的会话id
+type IdTokenClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Audience      string `json:"aud"`
+	ExpiresAt     int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	Nonce         string `json:"nonce,omitempty"`
+	Sid           string `json:"sid,omitempty"`
+	Role          int64  `json:"role"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+}
+
+// 发现文档，见 OpenID Connect Discovery 1.0
+func (s *OIDCService) Discovery() map[string]any {
+	return map[string]any{
+		"issuer":                                s.Config.OIDCConf.Issuer,
+		"authorization_endpoint":                s.endpoint("/authorize"),
+		"token_endpoint":                        s.endpoint("/token"),
+		"userinfo_endpoint":                     s.endpoint("/userinfo"),
+		"jwks_uri":                              s.endpoint("/jwks"),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{s.Config.KeyConf.Algorithm},
+		"scopes_supported":                      []string{ScopeOpenId, ScopeEmail},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "nonce", "sid", "role", "email", "email_verified"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+func (s *OIDCService) JWKS() ([]byte, error) {
+	return s.Keyring.JWKS()
+}
+
+// 授权端点，返回需要跳转的地址
+//   - 客户端或回调地址无效时返回 OIDCError，不跳转到未注册的地址
+//   - 其余错误按规范附加在回调地址上返回给客户端
+//   - 未登录时跳转到登录页，登录后携带访问令牌重新请求授权端点
+//   - 用户未同意客户端使用所申请的授权范围时跳转到授权确认页，确认页携带访问令牌与用户选择 POST 到授权端点
+func (s *OIDCService) Authorize(ctx context.Context, req *AuthorizeReq) (location string, err error) {
+	client, err := s.ClientMongoMapper.FindOneByClientId(ctx, req.ClientId)
+	if errors.Is(err, consts.ErrNotFound) {
+		return "", oidcError(http.StatusBadRequest, "invalid_client", "unknown client_id")
+	}
+	if err != nil {
+		return "", err
+	}
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !lo.Contains(client.RedirectURIs, redirectURI) {
+		return "", oidcError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered")
+	}
+	fail := func(code, description string) (string, error) {
+		return withQuery(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "only the code response type is supported")
+	}
+	scopes := lo.Uniq(strings.Fields(req.Scope))
+	if !lo.Contains(scopes, ScopeOpenId) {
+		return fail("invalid_scope", "the openid scope is required")
+	}
+	if len(client.Scopes) > 0 && len(lo.Without(scopes, client.Scopes...)) > 0 {
+		return fail("invalid_scope", "scope is not allowed for this client")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "PKCE with the S256 method is required")
+	}
+
+	claims, active, err := s.TokenManager.Introspect(ctx, req.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	// Introspect 只接受登录签发的访问令牌，客户端获得的令牌不能再用于授权其他客户端
+	if !active {
+		if req.Prompt == "none" || s.Config.OIDCConf.LoginURL == "" {
+			return fail("login_required", "the user is not logged in")
+		}
+		return withQuery(s.Config.OIDCConf.LoginURL, url.Values{"return_to": {s.authorizeURL(req)}}), nil
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, claims.Subject)
+	if err != nil {
+		return "", err
+	}
+	if err = checkUserStatus(user); err != nil {
+		return fail("access_denied", "the account is not active")
+	}
+	switch {
+	case req.Consent == ConsentDeny:
+		return fail("access_denied", "the user denied the request")
+	case req.Consent == ConsentApprove:
+		if err = s.UserMongoMapper.GrantConsent(ctx, claims.Subject, client.ClientId, scopes); err != nil {
+			return "", err
+		}
+	case client.SkipConsent:
+	case req.Prompt == "consent" || !consented(user, client.ClientId, scopes):
+		if req.Prompt == "none" || s.Config.OIDCConf.ConsentURL == "" {
+			return fail("consent_required", "the user has not approved this client")
+		}
+		return withQuery(s.Config.OIDCConf.ConsentURL, url.Values{
+			"return_to": {s.authorizeURL(req)},
+			"client_id": {client.ClientId},
+			"scope":     {strings.Join(scopes, " ")},
+		}), nil
+	}
+
+	code, err := s.TicketStore.Issue(ctx, consts.OIDCCode, &AuthorizationCode{
+		ClientId:      client.ClientId,
+		RedirectURI:   req.RedirectURI,
+		UserId:        claims.Subject,
+		Sid:           claims.Sid,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+	}, s.Config.OIDCConf.CodeTTL)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(redirectURI, url.Values{"code": {code}, "state": {req.State}}), nil
+}
+
+// 令牌端点，用授权码换取访问令牌与 ID 令牌，不创建新的会话，令牌随用户授权时的登录会话一起失效
+func (s *OIDCService) Token(ctx context.Context, req *OIDCTokenReq) (resp *OIDCTokenResp, err error) {
+	if req.GrantType != "authorization_code" {
+		return nil, oidcError(http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+	}
+	client, err := s.authenticateClient(ctx, req.ClientId, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	code := new(AuthorizationCode)
+	err = s.TicketStore.Consume(ctx, consts.OIDCCode, req.Code, code)
+	if errors.Is(err, consts.ErrInvalidTicket) {
+		return nil, oidcError(http.StatusBadRequest, "invalid_grant", "code is invalid or expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientId != client.ClientId || code.RedirectURI != req.RedirectURI || !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, oidcError(http.StatusBadRequest, "invalid_grant", "code was issued for another request")
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, code.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkUserStatus(user); err != nil {
+		return nil, oidcError(http.StatusBadRequest, "invalid_grant", "the account is not active")
+	}
+
+	accessToken, expiresIn, err := s.TokenManager.IssueClientAccess(user.ID.Hex(), user.Role, client.ClientId, code.Sid, code.Scope, s.Config.OIDCConf.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := s.idToken(user, client.ClientId, code)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCTokenResp{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		IdToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// 用户信息端点，只接受通过授权码获得的带 openid 授权范围的访问令牌
+func (s *OIDCService) UserInfo(ctx context.Context, accessToken string) (info map[string]any, err error) {
+	claims, active, err := s.TokenManager.IntrospectClientAccess(ctx, accessToken, s.Config.OIDCConf.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	if !active || !lo.Contains(strings.Fields(claims.Scope), ScopeOpenId) {
+		return nil, oidcError(http.StatusUnauthorized, "invalid_token", "access token is invalid or lacks the openid scope")
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, claims.Subject)
+	if errors.Is(err, consts.ErrNotFound) {
+		return nil, oidcError(http.StatusUnauthorized, "invalid_token", "user does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(claims.Scope)
+	info = map[string]any{
+		"sub":  user.ID.Hex(),
+		"role": user.Role,
+	}
+	if email := userEmail(user); email != "" && lo.Contains(scopes, ScopeEmail) {
+		info["email"] = email
+		info["email_verified"] = true
+	}
+	return info, nil
+}
+
+// 公开客户端不校验密钥，依靠 PKCE 保证授权码不被截获后使用
+func (s *OIDCService) authenticateClient(ctx context.Context, clientId, secret string) (*clientmapper.Client, error) {
+	client, err := s.ClientMongoMapper.FindOneByClientId(ctx, clientId)
+	if errors.Is(err, consts.ErrNotFound) {
+		return nil, oidcError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.Secret != "" {
+		if ok, _, err := s.PasswordHasher.Verify(secret, client.Secret); err != nil || !ok {
+			return nil, oidcError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+	}
+	return client, nil
+}
+
+func (s *OIDCService) idToken(user *usermapper.User, clientId string, code *AuthorizationCode) (string, error) {
+	key, err := s.Keyring.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := &IdTokenClaims{
+		Issuer:    s.Config.OIDCConf.Issuer,
+		Subject:   user.ID.Hex(),
+		Audience:  clientId,
+		ExpiresAt: now.Add(time.Duration(s.Config.OIDCConf.IdTokenTTL) * time.Second).Unix(),
+		IssuedAt:  now.Unix(),
+		Nonce:     code.Nonce,
+		Sid:       code.Sid,
+		Role:      user.Role,
+	}
+	if email := userEmail(user); email != "" && lo.Contains(strings.Fields(code.Scope), ScopeEmail) {
+		claims.Email = email
+		claims.EmailVerified = true
+	}
+	return jwt.Sign(&jwt.Header{Alg: key.Algorithm, Kid: key.Kid}, claims, key.Signer)
+}
+
+// 未登录时重新发起授权请求的地址，不包含访问令牌
+func (s *OIDCService) authorizeURL(req *AuthorizeReq) string {
+	return withQuery(s.endpoint("/authorize"), url.Values{
+		"client_id":             {req.ClientId},
+		"redirect_uri":          {req.RedirectURI},
+		"response_type":         {req.ResponseType},
+		"scope":                 {req.Scope},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	})
+}
+
+func (s *OIDCService) endpoint(path string) string {
+	return strings.TrimSuffix(s.Config.OIDCConf.Issuer, "/") + path
+}
+
+// verifyPKCE 校验 S256 方式的 code_verifier，见 RFC 7636
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// 用户是否已同意客户端使用全部所申请的授权范围
+func consented(user *usermapper.User, clientId string, scopes []string) bool {
+	consent, ok := lo.Find(user.Consents, func(consent *usermapper.Consent) bool {
+		return consent.ClientId == clientId
+	})
+	return ok && lo.Every(consent.Scopes, scopes)
+}
+
+// 邮箱登录方式均经过验证码校验，可以作为已验证的邮箱
+func userEmail(user *usermapper.User) string {
+	auth, _ := lo.Find(user.Auths, func(auth *usermapper.Auth) bool {
+		return auth.Type == consts.EmailAuthType
+	})
+	if auth == nil {
+		return ""
+	}
+	return auth.AppId
+}
+
+// withQuery 在地址上追加查询参数，忽略空值
+func withQuery(raw string, values url.Values) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	for k, vs := range values {
+		if len(vs) > 0 && vs[0] != "" {
+			q.Set(k, vs[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/webauthn"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// PasskeyCeremony 注册仪式的挑战对应的用户，登录仪式不绑定用户
+type PasskeyCeremony struct {
+	UserId string `json:"userId,omitempty"`
+}
+
+// 开始注册通行密钥，返回 PublicKeyCredentialCreationOptions 的 JSON
+func (s *AuthServiceImpl) BeginPasskeyRegistration(ctx context.Context, req *gensts.BeginPasskeyRegistrationReq) (resp *gensts.BeginPasskeyRegistrationResp, err error) {
+	resp = new(gensts.BeginPasskeyRegistrationResp)
+	if !s.WebAuthn.Enabled() {
+		return resp, consts.ErrAuthNotSupported
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	challenge, err := s.TicketStore.Issue(ctx, consts.PasskeyRegister, &PasskeyCeremony{UserId: req.UserId}, s.Config.WebAuthnConf.Timeout)
+	if err != nil {
+		return resp, err
+	}
+	name := accountName(user)
+	options, err := s.WebAuthn.CreationOptions(challenge, &webauthn.UserEntity{
+		Id:          user.ID.Hex(),
+		Name:        name,
+		DisplayName: name,
+	}, lo.Map(user.Passkeys, func(passkey *usermapper.Passkey, _ int) string {
+		return passkey.CredentialId
+	}))
+	if err != nil {
+		return resp, err
+	}
+	resp.Options = string(options)
+	return resp, nil
+}
+
+// 完成注册，校验认证器返回的证明并保存凭证公钥
+func (s *AuthServiceImpl) FinishPasskeyRegistration(ctx context.Context, req *gensts.FinishPasskeyRegistrationReq) (resp *gensts.FinishPasskeyRegistrationResp, err error) {
+	resp = new(gensts.FinishPasskeyRegistrationResp)
+	if !s.WebAuthn.Enabled() {
+		return resp, consts.ErrAuthNotSupported
+	}
+	challenge, err := s.WebAuthn.Challenge(req.ClientDataJson)
+	if err != nil {
+		return resp, consts.ErrPasskeyInvalid
+	}
+	ceremony := new(PasskeyCeremony)
+	if err = s.TicketStore.Consume(ctx, consts.PasskeyRegister, challenge, ceremony); err != nil {
+		return resp, err
+	}
+	if ceremony.UserId != req.UserId {
+		return resp, consts.ErrInvalidTicket
+	}
+	credential, err := s.WebAuthn.FinishRegistration(challenge, req.ClientDataJson, req.AttestationObject)
+	if err != nil {
+		log.CtxInfo(ctx, "通行密钥注册校验失败[%v], userId=%s", err, req.UserId)
+		return resp, consts.ErrPasskeyInvalid
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(credential.ID)
+	auth := &usermapper.Auth{
+		Type:    consts.PasskeyAuthType,
+		AppId:   s.WebAuthn.RPID(),
+		UnionId: credentialId,
+	}
+	_, err = s.UserMongoMapper.FindOneByAuth(ctx, auth)
+	switch {
+	case err == nil:
+		return resp, consts.ErrAuthExist
+	case !errors.Is(err, consts.ErrNotFound):
+		return resp, err
+	}
+	if err = s.UserMongoMapper.AddPasskey(ctx, req.UserId, &usermapper.Passkey{
+		CredentialId: credentialId,
+		PublicKey:    credential.PublicKey,
+		Algorithm:    credential.Algorithm,
+		SignCount:    int64(credential.SignCount),
+		Transports:   req.Transports,
+		Name:         req.Name,
+	}, auth); err != nil {
+		return resp, err
+	}
+	resp.CredentialId = credentialId
+	return resp, nil
+}
+
+// 开始通行密钥登录，不指定用户，由认证器选择可发现凭证
+func (s *AuthServiceImpl) BeginPasskeyLogin(ctx context.Context, req *gensts.BeginPasskeyLoginReq) (resp *gensts.BeginPasskeyLoginResp, err error) {
+	resp = new(gensts.BeginPasskeyLoginResp)
+	if !s.WebAuthn.Enabled() {
+		return resp, consts.ErrAuthNotSupported
+	}
+	challenge, err := s.TicketStore.Issue(ctx, consts.PasskeyLogin, &PasskeyCeremony{}, s.Config.WebAuthnConf.Timeout)
+	if err != nil {
+		return resp, err
+	}
+	options, err := s.WebAuthn.RequestOptions(challenge, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Options = string(options)
+	return resp, nil
+}
+
+// 完成通行密钥登录，按凭证id找到用户并校验断言签名
+func (s *AuthServiceImpl) FinishPasskeyLogin(ctx context.Context, req *gensts.FinishPasskeyLoginReq) (resp *gensts.LoginResp, err error) {
+	resp = new(gensts.LoginResp)
+	if !s.WebAuthn.Enabled() {
+		return resp, consts.ErrAuthNotSupported
+	}
+	challenge, err := s.WebAuthn.Challenge(req.ClientDataJson)
+	if err != nil {
+		return resp, consts.ErrPasskeyInvalid
+	}
+	if err = s.TicketStore.Consume(ctx, consts.PasskeyLogin, challenge, new(PasskeyCeremony)); err != nil {
+		return resp, err
+	}
+
+	user, err := s.UserMongoMapper.FindOneByAuth(ctx, &usermapper.Auth{
+		Type:    consts.PasskeyAuthType,
+		AppId:   s.WebAuthn.RPID(),
+		UnionId: req.CredentialId,
+	})
+	if errors.Is(err, consts.ErrNotFound) {
+		return resp, consts.ErrPasskeyInvalid
+	}
+	if err != nil {
+		return resp, err
+	}
+	// 可发现凭证返回的 userHandle 必须与凭证所属用户一致
+	if len(req.UserHandle) > 0 && string(req.UserHandle) != user.ID.Hex() {
+		return resp, consts.ErrPasskeyInvalid
+	}
+	if err = s.checkPasskeyAssertion(ctx, user, challenge, req.CredentialId, req.ClientDataJson, req.AuthenticatorData, req.Signature); err != nil {
+		return resp, err
+	}
+
+	return s.completeLogin(ctx, user, &token.Device{
+		DeviceName: req.DeviceName,
+		UserAgent:  req.UserAgent,
+		Ip:         req.Ip,
+		AuthType:   consts.PasskeyAuthType,
+	}, resp)
+}
+
+// 校验用户某个通行密钥对已消费挑战的断言签名，并更新签名计数
+func (s *AuthServiceImpl) checkPasskeyAssertion(ctx context.Context, user *usermapper.User, challenge, credentialId string, clientDataJson, authenticatorData, signature []byte) error {
+	passkey, ok := lo.Find(user.Passkeys, func(passkey *usermapper.Passkey) bool {
+		return passkey.CredentialId == credentialId
+	})
+	if !ok {
+		return consts.ErrPasskeyInvalid
+	}
+	signCount, err := s.WebAuthn.FinishLogin(challenge, passkey.PublicKey, uint32(passkey.SignCount), clientDataJson, authenticatorData, signature)
+	if err != nil {
+		log.CtxInfo(ctx, "通行密钥断言校验失败[%v], userId=%s", err, user.ID.Hex())
+		return consts.ErrPasskeyInvalid
+	}
+	return s.UserMongoMapper.TouchPasskey(ctx, user.ID.Hex(), passkey.CredentialId, int64(signCount))
+}
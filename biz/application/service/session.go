@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/google/wire"
+	"github.com/samber/lo"
+)
+
+type ISessionService interface {
+	ListSessions(ctx context.Context, req *gensts.ListSessionsReq) (resp *gensts.ListSessionsResp, err error)
+	RevokeSession(ctx context.Context, req *gensts.RevokeSessionReq) (resp *gensts.RevokeSessionResp, err error)
+	RevokeOtherSessions(ctx context.Context, req *gensts.RevokeOtherSessionsReq) (resp *gensts.RevokeOtherSessionsResp, err error)
+}
+
+type SessionService struct {
+	Config       *config.Config
+	TokenManager *token.Manager
+}
+
+var SessionSet = wire.NewSet(
+	wire.Struct(new(SessionService), "*"),
+	wire.Bind(new(ISessionService), new(*SessionService)),
+)
+
+// 列出用户当前登录的设备
+func (s *SessionService) ListSessions(ctx context.Context, req *gensts.ListSessionsReq) (resp *gensts.ListSessionsResp, err error) {
+	resp = new(gensts.ListSessionsResp)
+	sessions, err := s.TokenManager.Sessions(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	resp.Sessions = lo.Map(sessions, func(session *token.Session, _ int) *gensts.Session {
+		return &gensts.Session{
+			SessionId:    session.Id,
+			DeviceName:   session.DeviceName,
+			UserAgent:    session.UserAgent,
+			Ip:           session.Ip,
+			AuthType:     session.AuthType,
+			CreateTime:   session.CreateAt,
+			LastSeenTime: session.LastSeen,
+		}
+	})
+	return resp, nil
+}
+
+// 下线指定会话，会话的刷新令牌与访问令牌随即失效
+func (s *SessionService) RevokeSession(ctx context.Context, req *gensts.RevokeSessionReq) (resp *gensts.RevokeSessionResp, err error) {
+	resp = new(gensts.RevokeSessionResp)
+	if err = s.TokenManager.RevokeSession(ctx, req.UserId, req.SessionId); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 下线除当前会话以外的所有会话
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, req *gensts.RevokeOtherSessionsReq) (resp *gensts.RevokeOtherSessionsResp, err error) {
+	resp = new(gensts.RevokeOtherSessionsResp)
+	if err = s.TokenManager.RevokeOtherSessions(ctx, req.UserId, req.SessionId); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/keyring"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/google/wire"
+)
+
+type ITokenService interface {
+	RefreshToken(ctx context.Context, req *gensts.RefreshTokenReq) (resp *gensts.RefreshTokenResp, err error)
+	RevokeToken(ctx context.Context, req *gensts.RevokeTokenReq) (resp *gensts.RevokeTokenResp, err error)
+	GetJWKS(ctx context.Context, req *gensts.GetJWKSReq) (resp *gensts.GetJWKSResp, err error)
+	IntrospectToken(ctx context.Context, req *gensts.IntrospectTokenReq) (resp *gensts.IntrospectTokenResp, err error)
+	RevokeUserTokens(ctx context.Context, req *gensts.RevokeUserTokensReq) (resp *gensts.RevokeUserTokensResp, err error)
+}
+
+type TokenService struct {
+	Config          *config.Config
+	UserMongoMapper usermapper.IUserMongoMapper
+	TokenManager    *token.Manager
+	Keyring         *keyring.Keyring
+}
+
+var TokenSet = wire.NewSet(
+	wire.Struct(new(TokenService), "*"),
+	wire.Bind(new(ITokenService), new(*TokenService)),
+)
+
+// 使用刷新令牌换取新的令牌，旧刷新令牌随即失效
+func (s *TokenService) RefreshToken(ctx context.Context, req *gensts.RefreshTokenReq) (resp *gensts.RefreshTokenResp, err error) {
+	resp = new(gensts.RefreshTokenResp)
+	record, err := s.TokenManager.Rotate(ctx, req.RefreshToken)
+	if err != nil {
+		return resp, err
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, record.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if err = checkUserStatus(user); err != nil {
+		if e := s.TokenManager.RevokeFamily(ctx, record.Family); e != nil {
+			log.CtxError(ctx, "吊销令牌族失败[%v], userId=%s", e, record.UserId)
+		}
+		return resp, err
+	}
+	pair, err := s.TokenManager.IssueInFamily(ctx, record.Family, record.UserId, user.Role)
+	if err != nil {
+		return resp, err
+	}
+	resp.UserId = record.UserId
+	resp.AccessToken = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	resp.SessionId = pair.SessionId
+	return resp, nil
+}
+
+// 吊销刷新令牌及其所在令牌族，或将访问令牌加入吊销列表
+func (s *TokenService) RevokeToken(ctx context.Context, req *gensts.RevokeTokenReq) (resp *gensts.RevokeTokenResp, err error) {
+	resp = new(gensts.RevokeTokenResp)
+	if req.AccessToken != "" {
+		claims, err := s.TokenManager.Verify(req.AccessToken)
+		if err != nil {
+			return resp, err
+		}
+		if err = s.TokenManager.Revoke(ctx, claims); err != nil {
+			return resp, err
+		}
+	}
+	if req.RefreshToken != "" {
+		record, err := s.TokenManager.Lookup(ctx, req.RefreshToken)
+		if err != nil {
+			return resp, err
+		}
+		if err = s.TokenManager.RevokeFamily(ctx, record.Family); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// 按 RFC 7662 语义检查访问令牌是否有效，无效令牌只返回 Active=false
+func (s *TokenService) IntrospectToken(ctx context.Context, req *gensts.IntrospectTokenReq) (resp *gensts.IntrospectTokenResp, err error) {
+	resp = new(gensts.IntrospectTokenResp)
+	claims, active, err := s.TokenManager.Introspect(ctx, req.Token)
+	if err != nil || !active {
+		return resp, err
+	}
+	resp.Active = true
+	resp.Sub = claims.Subject
+	resp.Role = claims.Role
+	resp.Exp = claims.ExpiresAt
+	resp.Iat = claims.IssuedAt
+	resp.Jti = claims.ID
+	resp.Sid = claims.Sid
+	return resp, nil
+}
+
+// 退出所有设备，吊销用户的全部令牌
+func (s *TokenService) RevokeUserTokens(ctx context.Context, req *gensts.RevokeUserTokensReq) (resp *gensts.RevokeUserTokensResp, err error) {
+	resp = new(gensts.RevokeUserTokensResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if err = s.TokenManager.RevokeUser(ctx, user.ID.Hex()); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 获取验签公钥集合，供其他服务离线校验访问令牌
+func (s *TokenService) GetJWKS(ctx context.Context, req *gensts.GetJWKSReq) (resp *gensts.GetJWKSResp, err error) {
+	resp = new(gensts.GetJWKSResp)
+	jwks, err := s.Keyring.JWKS()
+	if err != nil {
+		return resp, err
+	}
+	resp.Jwks = string(jwks)
+	return resp, nil
+}
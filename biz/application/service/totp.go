@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/lockout"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/totp"
+	gensts "github.com/CloudStriver/service-idl-gen-go/kitex_gen/cloudmind/sts"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// LoginChallenge 开启两步验证的用户通过第一步校验后签发的挑战凭证内容
+type LoginChallenge struct {
+	UserId string        `json:"userId"`
+	Device *token.Device `json:"device"`
+}
+
+// 生成两步验证密钥，需使用 ConfirmTOTP 校验第一个验证码后才会启用
+func (s *AuthServiceImpl) EnrollTOTP(ctx context.Context, req *gensts.EnrollTOTPReq) (resp *gensts.EnrollTOTPResp, err error) {
+	resp = new(gensts.EnrollTOTPResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if user.TOTP != nil && user.TOTP.Enabled {
+		return resp, consts.ErrTOTPEnabled
+	}
+	secret, err := s.TOTP.GenerateSecret()
+	if err != nil {
+		return resp, err
+	}
+	encrypted, err := s.Cipher.Encrypt([]byte(secret))
+	if err != nil {
+		return resp, err
+	}
+	if err = s.UserMongoMapper.SetTOTP(ctx, req.UserId, &usermapper.TOTP{Secret: encrypted}); err != nil {
+		return resp, err
+	}
+	resp.Secret = secret
+	resp.Uri = s.TOTP.URI(secret, accountName(user))
+	return resp, nil
+}
+
+// 校验认证器生成的第一个验证码并启用两步验证，恢复码只在此时返回一次
+func (s *AuthServiceImpl) ConfirmTOTP(ctx context.Context, req *gensts.ConfirmTOTPReq) (resp *gensts.ConfirmTOTPResp, err error) {
+	resp = new(gensts.ConfirmTOTPResp)
+	user, err := s.UserMongoMapper.FindOne(ctx, req.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if user.TOTP == nil {
+		return resp, consts.ErrTOTPNotEnrolled
+	}
+	if user.TOTP.Enabled {
+		return resp, consts.ErrTOTPEnabled
+	}
+	if err = s.checkTOTPCode(ctx, user, req.Code); err != nil {
+		return resp, err
+	}
+	codes, hashes, err := s.TOTP.RecoveryCodes()
+	if err != nil {
+		return resp, err
+	}
+	if err = s.UserMongoMapper.EnableTOTP(ctx, req.UserId, hashes); err != nil {
+		return resp, err
+	}
+	resp.RecoveryCodes = codes
+	return resp, nil
+}
+
+// 使用挑战凭证与两步验证码（或恢复码）完成登录，挑战凭证只能使用一次
+func (s *AuthServiceImpl) VerifySecondFactor(ctx context.Context, req *gensts.VerifySecondFactorReq) (resp *gensts.LoginResp, err error) {
+	resp = new(gensts.LoginResp)
+	challenge := new(LoginChallenge)
+	if err = s.TicketStore.Consume(ctx, consts.LoginChallenge, req.ChallengeToken, challenge); err != nil {
+		return resp, err
+	}
+	lockKey := lockout.UserKey(challenge.UserId)
+	if err = s.checkLocked(ctx, lockKey); err != nil {
+		return resp, err
+	}
+	user, err := s.UserMongoMapper.FindOne(ctx, challenge.UserId)
+	if err != nil {
+		return resp, err
+	}
+	if user.TOTP == nil || !user.TOTP.Enabled {
+		return resp, consts.ErrTOTPNotEnrolled
+	}
+
+	if req.RecoveryCode != "" {
+		var ok bool
+		if ok, err = s.UserMongoMapper.UseRecoveryCode(ctx, challenge.UserId, totp.HashRecoveryCode(req.RecoveryCode)); err == nil && !ok {
+			err = consts.ErrSecondFactor
+		}
+	} else {
+		err = s.checkTOTPCode(ctx, user, req.Code)
+	}
+	switch {
+	case err == nil:
+		if e := s.Lockout.Reset(ctx, lockKey); e != nil {
+			log.CtxError(ctx, "清除登录失败计数失败[%v], userId=%s", e, challenge.UserId)
+		}
+	case errors.Is(err, consts.ErrSecondFactor):
+		wait, e := s.Lockout.Fail(ctx, lockKey)
+		if e != nil {
+			log.CtxError(ctx, "记录登录失败次数失败[%v], userId=%s", e, challenge.UserId)
+		}
+		if wait > 0 {
+			return resp, consts.RetryAfter(consts.ErrAccountLocked, wait)
+		}
+		return resp, err
+	default:
+		return resp, err
+	}
+
+	// 挑战签发后账号状态可能已被修改
+	if err = checkUserStatus(user); err != nil {
+		return resp, err
+	}
+	return s.issueLoginTokens(ctx, user, challenge.Device, resp)
+}
+
+// 校验两步验证码并计入用户的失败次数，用于登录以外需要重新验证身份的操作
+func (s *AuthServiceImpl) checkTOTPWithLockout(ctx context.Context, user *usermapper.User, code string) error {
+	if user.TOTP == nil || !user.TOTP.Enabled {
+		return consts.ErrTOTPNotEnrolled
+	}
+	lockKey := lockout.UserKey(user.ID.Hex())
+	if err := s.checkLocked(ctx, lockKey); err != nil {
+		return err
+	}
+	err := s.checkTOTPCode(ctx, user, code)
+	switch {
+	case err == nil:
+		if e := s.Lockout.Reset(ctx, lockKey); e != nil {
+			log.CtxError(ctx, "清除登录失败计数失败[%v], userId=%s", e, user.ID.Hex())
+		}
+	case errors.Is(err, consts.ErrSecondFactor):
+		wait, e := s.Lockout.Fail(ctx, lockKey)
+		if e != nil {
+			log.CtxError(ctx, "记录登录失败次数失败[%v], userId=%s", e, user.ID.Hex())
+		}
+		if wait > 0 {
+			return consts.RetryAfter(consts.ErrAccountLocked, wait)
+		}
+	}
+	return err
+}
+
+// 校验两步验证码，同一时间步的验证码只能使用一次
+func (s *AuthServiceImpl) checkTOTPCode(ctx context.Context, user *usermapper.User, code string) error {
+	secret, err := s.Cipher.Decrypt(user.TOTP.Secret)
+	if err != nil {
+		return err
+	}
+	counter, ok := s.TOTP.Validate(string(secret), code)
+	if !ok {
+		return consts.ErrSecondFactor
+	}
+	fresh, err := s.Redis.SetnxExCtx(ctx, fmt.Sprintf("%s:%s:%d", consts.TOTPUsed, user.ID.Hex(), counter), "1", s.TOTP.StepTTL())
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return consts.ErrSecondFactor
+	}
+	return nil
+}
+
+// 认证器中显示的账号名，优先使用邮箱
+func accountName(user *usermapper.User) string {
+	if auth, ok := lo.Find(user.Auths, func(auth *usermapper.Auth) bool {
+		return auth.Type == consts.EmailAuthType
+	}); ok {
+		return auth.AppId
+	}
+	return user.ID.Hex()
+}
@@ -40,6 +40,137 @@ type FilterConfig struct {
 	UseIgnoreCase                 bool
 }
 
+// PasswordConf 密码哈希参数，修改后已有密码会在下次登录时按新参数重新哈希
+type PasswordConf struct {
+	Algorithm   string `json:",default=argon2id,options=argon2id|bcrypt"`
+	Memory      uint32 `json:",default=65536"` // argon2id 内存开销，单位KiB
+	Iterations  uint32 `json:",default=3"`     // argon2id 迭代次数
+	Parallelism uint8  `json:",default=2"`     // argon2id 并行度
+	SaltLength  uint32 `json:",default=16"`
+	KeyLength   uint32 `json:",default=32"`
+	BcryptCost  int    `json:",default=12"`
+}
+
+// PasswordPolicyConf 设置密码时的强度要求，字符种类分为小写字母、大写字母、数字与其他字符
+type PasswordPolicyConf struct {
+	MinLength    int  `json:",default=8"`
+	MaxLength    int  `json:",default=64"`   // 过长的密码会放大哈希开销
+	MinClasses   int  `json:",default=2"`    // 至少包含的字符种类数
+	RejectEmail  bool `json:",default=true"` // 拒绝与邮箱或邮箱用户名相同的密码
+	RejectCommon bool `json:",default=true"` // 拒绝内置列表中的常见泄露密码
+	HistorySize  int  `json:",default=5"`    // 不能与最近几次使用的密码相同，包括当前密码，0 表示不检查
+}
+
+// LockoutConf 登录失败锁定策略，每次锁定时长在 BaseDuration 基础上翻倍，最长 MaxDuration
+type LockoutConf struct {
+	MaxAttempts  int64 `json:",default=5"`     // 窗口内允许的连续失败次数
+	Window       int   `json:",default=900"`   // 失败计数窗口，单位秒
+	BaseDuration int   `json:",default=60"`    // 首次锁定时长，单位秒
+	MaxDuration  int   `json:",default=86400"` // 最长锁定时长，单位秒
+	ResetAfter   int   `json:",default=86400"` // 锁定次数在最后一次锁定后多久清零，单位秒
+}
+
+// EmailLimitConf 验证码邮件发送频率限制，每日额度按本地时区零点重置
+type EmailLimitConf struct {
+	Cooldown            int `json:",default=60"` // 同一收件人两次发送的最短间隔，单位秒
+	RecipientDailyQuota int `json:",default=10"` // 同一收件人每日发送上限
+	IpDailyQuota        int `json:",default=50"` // 同一调用方IP每日发送上限
+}
+
+// CodePolicy 验证码生成策略，alphanumeric 字符集不含易混淆的 0/O/1/I/L
+type CodePolicy struct {
+	Length   int    `json:",default=6"`
+	Alphabet string `json:",default=numeric,options=numeric|alphanumeric"`
+}
+
+// VerifyCodeConf 验证码有效期、允许的错误次数与生成策略
+type VerifyCodeConf struct {
+	TTL         int                   `json:",default=300"` // 有效期，单位秒
+	MaxAttempts int64                 `json:",default=5"`   // 错误次数达到上限后验证码作废
+	TicketTTL   int                   `json:",default=300"` // 验证通过后凭证的有效期，单位秒
+	Policy      CodePolicy            // 默认生成策略
+	Policies    map[string]CodePolicy `json:",optional"` // 按用途覆盖默认生成策略
+}
+
+// TokenConf 访问令牌与刷新令牌的签发配置，签名密钥由 KeyConf 管理
+type TokenConf struct {
+	Issuer     string   `json:",default=cloudmind-sts"`
+	Audience   []string `json:",optional"`
+	AccessTTL  int      `json:",default=900"`     // 访问令牌有效期，单位秒
+	RefreshTTL int      `json:",default=2592000"` // 刷新令牌有效期，单位秒
+}
+
+// KeyConf 签名密钥轮换策略，新密钥在启用前 PrePublish 秒发布到 JWKS，停用后 GracePeriod 秒内仍可用于验签
+type KeyConf struct {
+	Algorithm       string `json:",default=ES256,options=ES256|RS256|EdDSA"`
+	RotationPeriod  int    `json:",default=2592000"` // 每个密钥用于签名的时长，单位秒
+	GracePeriod     int    `json:",default=86400"`   // 停用后仍可验签的时长，应大于访问令牌有效期
+	PrePublish      int    `json:",default=86400"`   // 新密钥提前发布的时长，单位秒
+	RefreshInterval int    `json:",default=60"`      // 重新加载与检查轮换的间隔，单位秒
+}
+
+// TOTPConf 两步验证参数，修改 Digits 或 Period 会使已绑定的认证器失效
+type TOTPConf struct {
+	Issuer        string `json:",default=CloudMind"`
+	Digits        int    `json:",default=6,options=6|8"`
+	Period        int    `json:",default=30"`  // 时间步长，单位秒
+	Skew          int    `json:",default=1"`   // 允许前后偏差的时间步数
+	RecoveryCodes int    `json:",default=10"`  // 生成的恢复码数量
+	ChallengeTTL  int    `json:",default=300"` // 登录挑战凭证有效期，单位秒
+}
+
+// WebAuthnConf 通行密钥配置，RPID 为空时不启用通行密钥
+type WebAuthnConf struct {
+	RPID             string   `json:",optional"` // 依赖方id，通常为站点的可注册域名
+	RPName           string   `json:",default=CloudMind"`
+	Origins          []string `json:",optional"`    // 允许发起仪式的源，如 https://example.com
+	Timeout          int      `json:",default=300"` // 仪式有效期，单位秒
+	UserVerification string   `json:",default=preferred,options=required|preferred|discouraged"`
+}
+
+// EmailLoginConf 邮箱免密登录配置，LinkURL 为空时只发送验证码
+type EmailLoginConf struct {
+	LinkURL string `json:",optional"` // 登录页地址，登录令牌附加在 token 查询参数中
+}
+
+// OAuthProviderConf 第三方登录提供方，github/wechat/qq 未配置的端点使用官方地址，通用 oauth2 必须配置 TokenURL 与 UserInfoURL
+type OAuthProviderConf struct {
+	Name         string // 请求中通过名称选择提供方
+	Type         string `json:",default=oauth2,options=oauth2|github|wechat|qq"`
+	AuthType     int64  // 写入 Auth.Type 的登录方式，不能与其他提供方重复
+	AppId        string `json:",optional"` // 写入 Auth.AppId，默认为 ClientId，多个微信应用共享 unionid 时应配置为相同的值
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string `json:",optional"`   // 请求未携带回调地址时使用
+	TokenURL     string `json:",optional"`   // 授权码换取访问令牌的地址
+	UserInfoURL  string `json:",optional"`   // 获取用户唯一标识的地址，qq 为 /oauth2.0/me
+	UnionIdField string `json:",optional"`   // 通用 oauth2 用户信息中作为唯一标识的字段，默认为 sub
+	Timeout      int    `json:",default=10"` // 请求提供方的超时时间，单位秒
+}
+
+// OAuthConf 第三方登录配置，配置了提供方的登录方式只能通过授权码登录与绑定
+type OAuthConf struct {
+	Providers []OAuthProviderConf `json:",optional"`
+}
+
+// OIDCConf OpenID Connect 提供方配置，ListenOn 为空时不启动 HTTP 服务
+type OIDCConf struct {
+	ListenOn   string `json:",optional"`
+	Issuer     string `json:",optional"`     // 对外访问的基础地址，如 https://sts.example.com，各端点地址由此拼接
+	LoginURL   string `json:",optional"`     // 未登录时跳转的登录页，原授权请求地址附加在 return_to 查询参数中
+	ConsentURL string `json:",optional"`     // 授权确认页，原授权请求地址附加在 return_to 查询参数中，为空时未确认的授权请求均被拒绝
+	CodeTTL    int    `json:",default=60"`   // 授权码有效期，单位秒
+	IdTokenTTL int    `json:",default=3600"` // ID 令牌有效期，单位秒
+}
+
+// ChangeEmailConf 修改邮箱配置，修改后通知旧邮箱，旧邮箱可在 RevertTTL 内撤销修改
+type ChangeEmailConf struct {
+	RequireOldTicket bool   `json:",default=false"`  // 是否同时要求旧邮箱的验证凭证
+	RevertURL        string `json:",optional"`       // 撤销页地址，撤销令牌附加在 token 查询参数中
+	RevertTTL        int    `json:",default=604800"` // 撤销令牌有效期，单位秒
+	HistorySize      int    `json:",default=10"`     // 保留的修改记录条数
+}
+
 func (c *CosConfig) CosHost() string {
 	return fmt.Sprintf("https://%s.cos.%s.myqcloud.com", c.BucketName, c.Region)
 }
@@ -51,13 +182,27 @@ type Config struct {
 		URL string
 		DB  string
 	}
-	CacheConf     cache.CacheConf
-	Redis         *redis.RedisConf
-	EmailConf     EmailConf
-	CosConfig     *CosConfig
-	FileCosConfig *CosConfig
-	CdnConfig     *CDNConfig
-	FilterConfig  *FilterConfig
+	CacheConf          cache.CacheConf
+	Redis              *redis.RedisConf
+	EmailConf          EmailConf
+	CosConfig          *CosConfig
+	FileCosConfig      *CosConfig
+	CdnConfig          *CDNConfig
+	FilterConfig       *FilterConfig
+	PasswordConf       PasswordConf
+	PasswordPolicyConf PasswordPolicyConf
+	LockoutConf        LockoutConf
+	EmailLimitConf     EmailLimitConf
+	VerifyCodeConf     VerifyCodeConf
+	TokenConf          TokenConf
+	KeyConf            KeyConf
+	TOTPConf           TOTPConf
+	WebAuthnConf       WebAuthnConf
+	EmailLoginConf     EmailLoginConf
+	OAuthConf          OAuthConf
+	OIDCConf           OIDCConf
+	ChangeEmailConf    ChangeEmailConf
+	MasterKey          string // base64 编码的 32 字节主密钥，用于加密落库的敏感数据
 }
 
 func NewConfig() (*Config, error) {
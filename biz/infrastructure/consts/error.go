@@ -1,6 +1,12 @@
 package consts
 
-import "google.golang.org/grpc/status"
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
 
 var (
 	ErrPasswordNotEqual  = status.Error(20001, "密码错误")
@@ -10,4 +16,59 @@ var (
 	ErrNotFound          = status.Error(20006, "数据不存在")
 	ErrInvalidObjectId   = status.Error(20007, "ID格式错误")
 	ErrNotPassEmailCheck = status.Error(20008, "未通过邮箱验证")
+	ErrPasswordNotSet    = status.Error(20009, "未设置密码")
+	ErrAccountLocked     = status.Error(20010, "密码错误次数过多，账号已被临时锁定")
+	ErrSendTooFrequent   = status.Error(20011, "发送过于频繁，请稍后再试")
+	ErrSendOverQuota     = status.Error(20012, "今日发送次数已达上限")
+	ErrInvalidPurpose    = status.Error(20013, "验证码用途错误")
+	ErrInvalidTicket     = status.Error(20014, "凭证无效或已过期")
+	ErrInvalidToken      = status.Error(20015, "令牌无效或已过期")
+	ErrTokenReused       = status.Error(20016, "令牌已被使用，会话已失效")
+	ErrSessionNotFound   = status.Error(20017, "会话不存在或已失效")
+	ErrTOTPEnabled       = status.Error(20018, "已开启两步验证")
+	ErrTOTPNotEnrolled   = status.Error(20019, "未绑定两步验证")
+	ErrSecondFactor      = status.Error(20020, "两步验证码错误")
+	ErrPasskeyInvalid    = status.Error(20021, "通行密钥校验失败")
+	ErrAuthNotSupported  = status.Error(20022, "不支持该登录方式")
+	ErrUserNotFound      = status.Error(20023, "用户不存在")
+	ErrAccountDisabled   = status.Error(20024, "账号已被停用")
+	ErrAccountBanned     = status.Error(20025, "账号已被封禁")
+	ErrAccountPending    = status.Error(20026, "账号尚未完成验证")
+	ErrInvalidStatus     = status.Error(20027, "账号状态错误")
+	ErrLastAuth          = status.Error(20028, "不能解绑唯一的登录方式")
+	ErrAuthBound         = status.Error(20029, "该账号已被其他用户绑定")
+	ErrProviderNotFound  = status.Error(20030, "第三方登录方式未配置")
+	ErrOAuthFailed       = status.Error(20031, "第三方授权失败")
+	ErrAccountMerged     = status.Error(20032, "账号已合并到其他用户")
+	ErrMergeSelf         = status.Error(20033, "不能与自身合并")
+	ErrEmailNotBound     = status.Error(20034, "未绑定邮箱")
+	ErrWeakPassword      = status.Error(20035, "密码不符合安全要求")
+	ErrReauthRequired    = status.Error(20036, "需要重新验证身份")
+	ErrAuthExist         = status.Error(20037, "该登录方式已被注册")
 )
+
+// FieldViolations 在错误详情中附加 BadRequest，列出未通过校验的字段与原因
+func FieldViolations(err error, violations ...*errdetails.BadRequest_FieldViolation) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	st, e := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if e != nil {
+		return err
+	}
+	return st.Err()
+}
+
+// RetryAfter 在错误详情中附加 RetryInfo，告知客户端需要等待的时长
+func RetryAfter(err error, wait time.Duration) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	st, e := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)})
+	if e != nil {
+		return err
+	}
+	return st.Err()
+}
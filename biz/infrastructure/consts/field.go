@@ -1,15 +1,103 @@
 package consts
 
 const (
-	EmailCode       = "EmailCode"
-	ID              = "_id"
-	PassCheckEmail  = "PassCheckEmail"
-	Type            = "type"
-	AppId           = "appId"
-	UnionId         = "unionId"
-	PlatformId      = "platformId"
-	Auths           = "auths"
-	ReplaceChar     = '*'
-	EmailAuthType   = 1
-	DefaultPassword = "123456789"
+	EmailCode      = "EmailCode"
+	ID             = "_id"
+	EmailTicket    = "EmailTicket"
+	RefreshToken   = "RefreshToken"
+	TokenFamily    = "TokenFamily"
+	UserFamilies   = "UserTokenFamilies"
+	RevokedToken   = "RevokedToken"
+	UserRevokedAt  = "UserRevokedAt"
+	Type           = "type"
+	AppId          = "appId"
+	UnionId        = "unionId"
+	PlatformId     = "platformId"
+	Auths          = "auths"
+	ReplaceChar    = '*'
+	EmailAuthType  = 1 // 保留的登录方式取值见 ReservedAuthTypes
+	PassWord       = "passWord"
+	LoginFail      = "LoginFail"
+	LoginLock      = "LoginLock"
+	LoginLockLevel = "LoginLockLevel"
+	EmailCooldown  = "EmailCooldown"
+	EmailQuota     = "EmailQuota"
+	EmailIpQuota   = "EmailIpQuota"
+	LoginChallenge = "LoginChallenge"
+	TOTPUsed       = "TOTPUsed"
+	TOTP           = "totp"
+	TOTPEnabled    = "totp.enabled"
+	RecoveryCodes  = "totp.recoveryCodes"
+	// LegacyDefaultPassword 旧版本为无密码登录方式写入的共享默认密码，仅用于迁移为未设置密码
+	LegacyDefaultPassword = "123456789"
 )
+
+// 通行密钥登录方式，AppId 为 RPID，UnionId 为 base64url 编码的凭证id
+// PasskeyAuthType 的取值在调用方与 IDL 约定的 authType 中保留给通行密钥，不能用于其他登录方式
+const (
+	PasskeyAuthType = 5
+	PasskeyRegister = "PasskeyRegister"
+	PasskeyLogin    = "PasskeyLogin"
+	Passkeys        = "passkeys"
+)
+
+// ReservedAuthTypes 由本服务定义含义的 authType 取值，第三方登录提供方不能使用
+var ReservedAuthTypes = map[int64]string{
+	EmailAuthType:   "email",
+	PasskeyAuthType: "passkey",
+}
+
+// 账号状态，旧数据没有状态字段，视为正常
+const (
+	StatusActive = iota
+	StatusDisabled
+	StatusBanned
+	StatusPendingVerification
+)
+
+// EmailLoginLink 邮箱登录链接中的一次性令牌
+const EmailLoginLink = "EmailLoginLink"
+
+// 修改邮箱，EmailRevert 为通知旧邮箱的撤销令牌，EmailLog 为用户的邮箱修改记录，EmailRevertField 为用户的撤销记录
+const (
+	EmailRevert      = "EmailRevert"
+	EmailLog         = "emailLog"
+	EmailRevertField = "emailRevert"
+)
+
+// OpenID Connect，OIDCCode 为授权码，Consents 为用户对客户端的授权记录
+const (
+	OIDCCode = "OIDCCode"
+	Consents = "consents"
+)
+
+// 账号合并，UserMergedEvents 为合并事件队列，其他服务按队列顺序消费并迁移数据
+const (
+	Merge            = "merge"
+	UserMergedEvents = "UserMergedEvents"
+)
+
+// 邮箱验证码用途，验证结果只能被同一用途的操作使用
+const (
+	PurposeRegister = iota + 1
+	PurposeResetPassword
+	PurposeChangeEmail
+	PurposeBindAccount
+	PurposeDeleteAccount
+	PurposeLogin
+	PurposeUnbindAccount
+)
+
+// PurposeNames 用途名称，用于按用途配置验证码生成策略
+var PurposeNames = map[int64]string{
+	PurposeRegister:      "register",
+	PurposeResetPassword: "resetPassword",
+	PurposeChangeEmail:   "changeEmail",
+	PurposeBindAccount:   "bindAccount",
+	PurposeDeleteAccount: "deleteAccount",
+	PurposeLogin:         "login",
+	PurposeUnbindAccount: "unbindAccount",
+}
+
+// PasswordHistory 用户最近使用过的密码哈希，不包括当前密码
+const PasswordHistory = "passwordHistory"
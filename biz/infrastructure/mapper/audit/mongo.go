@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	usermapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+	"github.com/zeromicro/go-zero/core/stores/monc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const CollectionName = "audit_log"
+
+const (
+	ActionSetStatus = "setStatus"
+	ActionMerge     = "merge"
+)
+
+var _ IAuditMongoMapper = (*MongoMapper)(nil)
+
+type (
+	IAuditMongoMapper interface {
+		Insert(ctx context.Context, data *AuditLog) (string, error)                                   // 插入
+		FindByUser(ctx context.Context, userId string, skip, limit int64) ([]*AuditLog, int64, error) // 按时间倒序分页查询用户的审计记录
+	}
+	// AuditLog 管理操作的审计记录，只追加不修改
+	AuditLog struct {
+		ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+		UserId     string             `bson:"userId,omitempty" json:"userId,omitempty"`
+		Action     string             `bson:"action,omitempty" json:"action,omitempty"`
+		OperatorId string             `bson:"operatorId,omitempty" json:"operatorId,omitempty"`
+		Reason     string             `bson:"reason,omitempty" json:"reason,omitempty"`
+		Before     *usermapper.Status `bson:"before,omitempty" json:"before,omitempty"`
+		After      *usermapper.Status `bson:"after,omitempty" json:"after,omitempty"`
+		CreateAt   time.Time          `bson:"createAt,omitempty" json:"createAt,omitempty"`
+	}
+
+	MongoMapper struct {
+		conn *monc.Model
+	}
+)
+
+func NewMongoMapper(config *config.Config) IAuditMongoMapper {
+	conn := monc.MustNewModel(config.Mongo.URL, config.Mongo.DB, CollectionName, config.CacheConf)
+	return &MongoMapper{
+		conn: conn,
+	}
+}
+
+func (m *MongoMapper) Insert(ctx context.Context, data *AuditLog) (string, error) {
+	if data.ID.IsZero() {
+		data.ID = primitive.NewObjectID()
+		data.CreateAt = time.Now()
+	}
+	res, err := m.conn.InsertOneNoCache(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (m *MongoMapper) FindByUser(ctx context.Context, userId string, skip, limit int64) ([]*AuditLog, int64, error) {
+	var data []*AuditLog
+	filter := bson.M{"userId": userId}
+	err := m.conn.Find(ctx, &data, filter, options.Find().SetSort(bson.M{"createAt": -1}).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := m.conn.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, total, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/zeromicro/go-zero/core/stores/monc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const CollectionName = "oidc_client"
+
+var PrefixClientCacheKey = "cache:oidc_client:"
+
+var _ IClientMongoMapper = (*MongoMapper)(nil)
+
+type (
+	IClientMongoMapper interface {
+		Insert(ctx context.Context, data *Client) (string, error)                // 插入
+		FindOneByClientId(ctx context.Context, clientId string) (*Client, error) // 按客户端id查找
+	}
+	// Client 已注册的 OpenID Connect 客户端
+	Client struct {
+		ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+		ClientId     string             `bson:"clientId,omitempty" json:"clientId,omitempty"`
+		Secret       string             `bson:"secret,omitempty" json:"secret,omitempty"` // 按密码哈希参数处理后的客户端密钥，为空表示公开客户端
+		Name         string             `bson:"name,omitempty" json:"name,omitempty"`
+		RedirectURIs []string           `bson:"redirectUris,omitempty" json:"redirectUris,omitempty"` // 允许的回调地址，需完全匹配
+		Scopes       []string           `bson:"scopes,omitempty" json:"scopes,omitempty"`             // 允许申请的授权范围，为空时不限制
+		SkipConsent  bool               `bson:"skipConsent,omitempty" json:"skipConsent,omitempty"`   // 自有客户端授权时无需用户确认
+		CreateAt     time.Time          `bson:"createAt,omitempty" json:"createAt,omitempty"`
+		UpdateAt     time.Time          `bson:"updateAt,omitempty" json:"updateAt,omitempty"`
+	}
+
+	MongoMapper struct {
+		conn *monc.Model
+	}
+)
+
+func NewMongoMapper(config *config.Config) IClientMongoMapper {
+	conn := monc.MustNewModel(config.Mongo.URL, config.Mongo.DB, CollectionName, config.CacheConf)
+	_, err := conn.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}},
+		Options: options.Index().SetName("clientId_unique").SetUnique(true),
+	})
+	if err != nil {
+		log.Error("建立客户端id唯一索引失败[%v]", err)
+	}
+	return &MongoMapper{
+		conn: conn,
+	}
+}
+
+func (m *MongoMapper) Insert(ctx context.Context, data *Client) (string, error) {
+	if data.ID.IsZero() {
+		data.ID = primitive.NewObjectID()
+		data.CreateAt = time.Now()
+		data.UpdateAt = time.Now()
+	}
+	res, err := m.conn.InsertOne(ctx, PrefixClientCacheKey+data.ClientId, data)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", consts.ErrHaveExist
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (m *MongoMapper) FindOneByClientId(ctx context.Context, clientId string) (*Client, error) {
+	var data Client
+	err := m.conn.FindOne(ctx, PrefixClientCacheKey+clientId, &data, bson.M{"clientId": clientId})
+	switch {
+	case err == nil:
+		return &data, nil
+	case errors.Is(err, monc.ErrNotFound):
+		return nil, consts.ErrNotFound
+	default:
+		return nil, err
+	}
+}
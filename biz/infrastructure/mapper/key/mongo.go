@@ -0,0 +1,66 @@
+package key
+
+import (
+	"context"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/zeromicro/go-zero/core/stores/monc"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const CollectionName = "signing_key"
+
+var _ IKeyMongoMapper = (*MongoMapper)(nil)
+
+type (
+	IKeyMongoMapper interface {
+		Insert(ctx context.Context, data *SigningKey) (string, error)        // 插入
+		FindValid(ctx context.Context, now time.Time) ([]*SigningKey, error) // 查找仍可用于验签的密钥
+	}
+	SigningKey struct {
+		ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+		Kid        string             `bson:"kid,omitempty" json:"kid,omitempty"`
+		Algorithm  string             `bson:"algorithm,omitempty" json:"algorithm,omitempty"`
+		PrivateKey string             `bson:"privateKey,omitempty" json:"privateKey,omitempty"` // 主密钥加密的 PKCS#8 私钥
+		PublicKey  string             `bson:"publicKey,omitempty" json:"publicKey,omitempty"`   // base64 编码的 PKIX 公钥
+		ActivateAt time.Time          `bson:"activateAt,omitempty" json:"activateAt,omitempty"` // 开始用于签名
+		RetireAt   time.Time          `bson:"retireAt,omitempty" json:"retireAt,omitempty"`     // 停止用于签名
+		ExpireAt   time.Time          `bson:"expireAt,omitempty" json:"expireAt,omitempty"`     // 停止用于验签
+		CreateAt   time.Time          `bson:"createAt,omitempty" json:"createAt,omitempty"`
+	}
+
+	MongoMapper struct {
+		conn *monc.Model
+	}
+)
+
+func NewMongoMapper(config *config.Config) IKeyMongoMapper {
+	conn := monc.MustNewModel(config.Mongo.URL, config.Mongo.DB, CollectionName, config.CacheConf)
+	return &MongoMapper{
+		conn: conn,
+	}
+}
+
+func (m *MongoMapper) Insert(ctx context.Context, data *SigningKey) (string, error) {
+	if data.ID.IsZero() {
+		data.ID = primitive.NewObjectID()
+		data.CreateAt = time.Now()
+	}
+	res, err := m.conn.InsertOneNoCache(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (m *MongoMapper) FindValid(ctx context.Context, now time.Time) ([]*SigningKey, error) {
+	var data []*SigningKey
+	err := m.conn.Find(ctx, &data, bson.M{"expireAt": bson.M{"$gt": now}}, options.Find().SetSort(bson.M{"activateAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
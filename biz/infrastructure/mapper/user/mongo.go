@@ -3,8 +3,11 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/samber/lo"
 	"github.com/zeromicro/go-zero/core/stores/monc"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -28,6 +31,28 @@ type (
 		Delete(ctx context.Context, id string) (int64, error)                               // 删除
 		FindOneByAuth(ctx context.Context, auth *Auth) (*User, error)                       // 查找某个授权信息
 		AppendAuth(ctx context.Context, id string, auth *Auth) error                        // 追加授权信息
+		UnsetPassword(ctx context.Context, id string) error                                 // 清除密码
+		SetTOTP(ctx context.Context, id string, totp *TOTP) error                           // 保存未启用的两步验证密钥
+		EnableTOTP(ctx context.Context, id string, recoveryCodes []string) error            // 启用两步验证
+		UseRecoveryCode(ctx context.Context, id string, hash string) (bool, error)          // 使用一次恢复码
+		AddPasskey(ctx context.Context, id string, passkey *Passkey, auth *Auth) error      // 添加通行密钥及对应的授权信息
+		TouchPasskey(ctx context.Context, id, credentialId string, signCount int64) error   // 更新通行密钥签名计数与使用时间
+		SetStatus(ctx context.Context, id string, status *Status) error                     // 修改账号状态
+		RemoveAuth(ctx context.Context, id string, auth *Auth) error                        // 移除授权信息，不能移除最后一个
+		FindDuplicateAuths(ctx context.Context) ([]*DuplicateAuth, error)                   // 查找被多个用户共用的授权信息
+		EnsureAuthIndex(ctx context.Context) error                                          // 建立授权信息唯一索引
+		Merge(ctx context.Context, survivorId, mergedId string) (*User, error)              // 将授权信息与通行密钥移动到存活用户并标记为已合并
+		Unmerge(ctx context.Context, survivorId string, merged *User) error                 // 撤销合并
+		ChangeEmail(ctx context.Context, id string, change *EmailChange, keep int) error    // 替换邮箱授权信息并保留最近 keep 条修改记录
+		ChangePassword(ctx context.Context, id, hash, previous string, keep int) error      // 修改密码并将旧密码哈希记入历史，保留最近 keep 条
+		MigrateLegacyAuth(ctx context.Context, auth *Auth) error                            // 将同一第三方身份的旧授权信息改写为 auth
+		GrantConsent(ctx context.Context, id, clientId string, scopes []string) error       // 记录用户同意客户端使用的授权范围
+		FinishEmailRevert(ctx context.Context, id string, unsetTOTP bool) error             // 撤销邮箱修改后清除密码与撤销记录
+	}
+	// DuplicateAuth 被多个用户共用的授权信息
+	DuplicateAuth struct {
+		Auth    *Auth                `bson:"_id"`
+		UserIds []primitive.ObjectID `bson:"userIds"`
 	}
 	Auth struct {
 		Type       int64  `bson:"type" json:"type"`
@@ -35,11 +60,71 @@ type (
 		UnionId    string `bson:"unionId" json:"unionId"`
 		PlatformId string `bson:"platformId" json:"platformId"`
 	}
+	// TOTP 两步验证信息，密钥使用主密钥加密保存，恢复码只保存哈希
+	TOTP struct {
+		Secret        string    `bson:"secret" json:"secret"`
+		Enabled       bool      `bson:"enabled" json:"enabled"`
+		RecoveryCodes []string  `bson:"recoveryCodes,omitempty" json:"recoveryCodes,omitempty"`
+		EnableAt      time.Time `bson:"enableAt,omitempty" json:"enableAt,omitempty"`
+	}
+	// Passkey 通行密钥凭证，PublicKey 为 COSE_Key 编码的公钥
+	Passkey struct {
+		CredentialId string    `bson:"credentialId" json:"credentialId"`
+		PublicKey    []byte    `bson:"publicKey" json:"publicKey"`
+		Algorithm    int64     `bson:"algorithm" json:"algorithm"`
+		SignCount    int64     `bson:"signCount" json:"signCount"`
+		Transports   []string  `bson:"transports,omitempty" json:"transports,omitempty"`
+		Name         string    `bson:"name,omitempty" json:"name,omitempty"`
+		CreateAt     time.Time `bson:"createAt,omitempty" json:"createAt,omitempty"`
+		LastUsedAt   time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	}
+	// Status 账号状态，Until 为封禁截止时间，为空表示永久封禁
+	Status struct {
+		State      int64     `bson:"state" json:"state"`
+		Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+		OperatorId string    `bson:"operatorId,omitempty" json:"operatorId,omitempty"`
+		Until      time.Time `bson:"until,omitempty" json:"until,omitempty"`
+		UpdateAt   time.Time `bson:"updateAt,omitempty" json:"updateAt,omitempty"`
+	}
+	// Merge 用户已被合并，登录方式均已移动到 SurvivorId 对应的用户
+	Merge struct {
+		SurvivorId string    `bson:"survivorId" json:"survivorId"`
+		MergeAt    time.Time `bson:"mergeAt,omitempty" json:"mergeAt,omitempty"`
+	}
+	// EmailChange 绑定邮箱的修改记录，Reverted 表示该记录由撤销产生
+	EmailChange struct {
+		OldEmail string         `bson:"oldEmail" json:"oldEmail"`
+		NewEmail string         `bson:"newEmail" json:"newEmail"`
+		Reverted bool           `bson:"reverted,omitempty" json:"reverted,omitempty"`
+		ChangeAt time.Time      `bson:"changeAt" json:"changeAt"`
+		Revert   *PendingRevert `bson:"-" json:"-"` // 不为空时与修改一同记录为撤销状态，不写入修改记录
+	}
+	// PendingRevert 修改邮箱后可以撤销的状态，撤销期内的多次修改共用第一次修改时的记录，撤销时恢复到第一次修改前
+	PendingRevert struct {
+		Email    string    `bson:"email" json:"email"` // 第一次修改前的邮箱
+		Auths    []*Auth   `bson:"auths" json:"auths"` // 第一次修改前的授权信息，撤销时移除此后新增的授权信息
+		ChangeAt time.Time `bson:"changeAt" json:"changeAt"`
+		ExpireAt time.Time `bson:"expireAt" json:"expireAt"`
+	}
+	// Consent 用户同意某个客户端使用的授权范围，再次授权相同或更小的范围时无需确认
+	Consent struct {
+		ClientId string    `bson:"clientId" json:"clientId"`
+		Scopes   []string  `bson:"scopes" json:"scopes"`
+		GrantAt  time.Time `bson:"grantAt" json:"grantAt"`
+	}
 	User struct {
 		ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 		PassWord string             `bson:"passWord,omitempty" json:"passWord,omitempty"`
 		Role     int64              `bson:"role,omitempty" json:"role,omitempty"`
 		Auths    []*Auth            `bson:"auths,omitempty" json:"auths,omitempty"`
+		TOTP     *TOTP              `bson:"totp,omitempty" json:"totp,omitempty"`
+		Passkeys []*Passkey         `bson:"passkeys,omitempty" json:"passkeys,omitempty"`
+		Status   *Status            `bson:"status,omitempty" json:"status,omitempty"`
+		Merge    *Merge             `bson:"merge,omitempty" json:"merge,omitempty"`
+		EmailLog []*EmailChange     `bson:"emailLog,omitempty" json:"emailLog,omitempty"`
+		History  []string           `bson:"passwordHistory,omitempty" json:"passwordHistory,omitempty"` // 最近使用过的密码哈希，不包括当前密码
+		Consents []*Consent         `bson:"consents,omitempty" json:"consents,omitempty"`
+		Revert   *PendingRevert     `bson:"emailRevert,omitempty" json:"emailRevert,omitempty"`
 		UpdateAt time.Time          `bson:"updateAt,omitempty" json:"updateAt,omitempty"`
 		CreateAt time.Time          `bson:"createAt,omitempty" json:"createAt,omitempty"`
 	}
@@ -55,7 +140,10 @@ func (m *MongoMapper) AppendAuth(ctx context.Context, id string, auth *Auth) err
 		return err
 	}
 	key := PrefixUserCacheKey + id
-	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{"$push": bson.M{consts.Auths: bson.M{"$each": []*Auth{auth}}}})
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{"$addToSet": bson.M{consts.Auths: bson.M{"$each": []*Auth{auth}}}})
+	if mongo.IsDuplicateKeyError(err) {
+		return consts.ErrAuthBound
+	}
 	if err != nil {
 		return err
 	}
@@ -64,9 +152,404 @@ func (m *MongoMapper) AppendAuth(ctx context.Context, id string, auth *Auth) err
 
 func NewMongoMapper(config *config.Config) IUserMongoMapper {
 	conn := monc.MustNewModel(config.Mongo.URL, config.Mongo.DB, CollectionName, config.CacheConf)
-	return &MongoMapper{
+	m := &MongoMapper{
 		conn: conn,
 	}
+	m.migrateLegacyPassword(context.Background())
+	return m
+}
+
+// EnsureAuthIndex 建立授权信息的唯一索引，保证同一第三方账号只能属于一个用户
+// 已有重复数据时索引无法建立，需先通过 FindDuplicateAuths 找出并人工处理，由迁移命令在部署前执行
+func (m *MongoMapper) EnsureAuthIndex(ctx context.Context) error {
+	_, err := m.conn.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "auths.type", Value: 1},
+			{Key: "auths.appId", Value: 1},
+			{Key: "auths.unionId", Value: 1},
+			{Key: "auths.platformId", Value: 1},
+		},
+		// 没有授权信息的用户不参与唯一约束
+		Options: options.Index().SetName("auths_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"auths.type": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("建立授权信息唯一索引失败: %w", err)
+	}
+	return nil
+}
+
+// Merge 先从被合并用户移除授权信息再添加到存活用户，避免唯一索引冲突，添加失败时恢复被合并用户，返回被合并用户合并前的数据
+func (m *MongoMapper) Merge(ctx context.Context, survivorId, mergedId string) (*User, error) {
+	sid, err := primitive.ObjectIDFromHex(survivorId)
+	if err != nil {
+		return nil, consts.ErrInvalidObjectId
+	}
+	mid, err := primitive.ObjectIDFromHex(mergedId)
+	if err != nil {
+		return nil, consts.ErrInvalidObjectId
+	}
+	now := time.Now()
+	mergedKey := PrefixUserCacheKey + mergedId
+	var merged User
+	err = m.conn.FindOneAndUpdate(ctx, mergedKey, &merged, bson.M{consts.ID: mid, consts.Merge: bson.M{"$exists": false}}, bson.M{
+		"$set":   bson.M{consts.Merge: &Merge{SurvivorId: survivorId, MergeAt: now}, "updateAt": now},
+		"$unset": bson.M{consts.Auths: "", consts.Passkeys: ""},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.Before))
+	switch {
+	case errors.Is(err, monc.ErrNotFound):
+		return nil, consts.ErrAccountMerged
+	case err != nil:
+		return nil, err
+	}
+
+	update := bson.M{"$set": bson.M{"updateAt": now}}
+	if len(merged.Auths) > 0 {
+		update["$addToSet"] = bson.M{consts.Auths: bson.M{"$each": merged.Auths}}
+	}
+	if len(merged.Passkeys) > 0 {
+		update["$push"] = bson.M{consts.Passkeys: bson.M{"$each": merged.Passkeys}}
+	}
+	res, err := m.conn.UpdateOne(ctx, PrefixUserCacheKey+survivorId, bson.M{consts.ID: sid, consts.Merge: bson.M{"$exists": false}}, update)
+	if err == nil && res.MatchedCount == 0 {
+		err = consts.ErrAccountMerged
+	}
+	if err != nil {
+		if e := m.restoreMerged(ctx, &merged); e != nil {
+			log.Error("恢复被合并用户失败[%v], userId=%s, auths=%d", e, mergedId, len(merged.Auths))
+		}
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// Unmerge 撤销 Merge，先从存活用户移除被合并用户的授权信息与通行密钥再恢复被合并用户，merged 为 Merge 返回的合并前数据
+func (m *MongoMapper) Unmerge(ctx context.Context, survivorId string, merged *User) error {
+	sid, err := primitive.ObjectIDFromHex(survivorId)
+	if err != nil {
+		return consts.ErrInvalidObjectId
+	}
+	pull := bson.M{}
+	if len(merged.Auths) > 0 {
+		pull[consts.Auths] = bson.M{"$in": merged.Auths}
+	}
+	if len(merged.Passkeys) > 0 {
+		pull[consts.Passkeys] = bson.M{"credentialId": bson.M{"$in": lo.Map(merged.Passkeys, func(p *Passkey, _ int) string {
+			return p.CredentialId
+		})}}
+	}
+	if len(pull) > 0 {
+		if _, err = m.conn.UpdateOne(ctx, PrefixUserCacheKey+survivorId, bson.M{consts.ID: sid},
+			bson.M{"$pull": pull, "$set": bson.M{"updateAt": time.Now()}}); err != nil {
+			return err
+		}
+	}
+	return m.restoreMerged(ctx, merged)
+}
+
+// 清除被合并用户的合并标记并写回合并前的授权信息与通行密钥
+func (m *MongoMapper) restoreMerged(ctx context.Context, merged *User) error {
+	set := bson.M{"updateAt": time.Now()}
+	if len(merged.Auths) > 0 {
+		set[consts.Auths] = merged.Auths
+	}
+	if len(merged.Passkeys) > 0 {
+		set[consts.Passkeys] = merged.Passkeys
+	}
+	_, err := m.conn.UpdateOne(ctx, PrefixUserCacheKey+merged.ID.Hex(), bson.M{consts.ID: merged.ID},
+		bson.M{"$unset": bson.M{consts.Merge: ""}, "$set": set})
+	return err
+}
+
+// ChangeEmail 只在用户当前仍绑定 OldEmail 时替换，替换、修改记录与撤销状态在同一次更新中完成
+func (m *MongoMapper) ChangeEmail(ctx context.Context, id string, change *EmailChange, keep int) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return consts.ErrInvalidObjectId
+	}
+	key := PrefixUserCacheKey + id
+	change.ChangeAt = time.Now()
+	filter := bson.M{
+		consts.ID: ID,
+		consts.Auths: bson.M{"$elemMatch": bson.M{
+			consts.Type:  consts.EmailAuthType,
+			consts.AppId: change.OldEmail,
+		}},
+	}
+	set := bson.M{"auths.$." + consts.AppId: change.NewEmail, "updateAt": change.ChangeAt}
+	if change.Revert != nil {
+		set[consts.EmailRevertField] = change.Revert
+	}
+	update := bson.M{"$set": set}
+	if keep > 0 {
+		update["$push"] = bson.M{consts.EmailLog: bson.M{"$each": []*EmailChange{change}, "$slice": -keep}}
+	}
+	res, err := m.conn.UpdateOne(ctx, key, filter, update)
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return consts.ErrHaveExist
+	case err != nil:
+		return err
+	case res.MatchedCount == 0:
+		return consts.ErrEmailNotBound
+	}
+	return nil
+}
+
+// FinishEmailRevert 修改邮箱的一方可能已设置密码或开启两步验证，撤销后一并清除，用户需通过邮箱重新设置密码
+func (m *MongoMapper) FinishEmailRevert(ctx context.Context, id string, unsetTOTP bool) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return consts.ErrInvalidObjectId
+	}
+	key := PrefixUserCacheKey + id
+	unset := bson.M{consts.PassWord: "", consts.EmailRevertField: ""}
+	if unsetTOTP {
+		unset[consts.TOTP] = ""
+	}
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{"$unset": unset, "$set": bson.M{"updateAt": time.Now()}})
+	return err
+}
+
+// ChangePassword previous 为空或 keep 不大于 0 时只修改密码，不记录历史
+func (m *MongoMapper) ChangePassword(ctx context.Context, id, hash, previous string, keep int) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return consts.ErrInvalidObjectId
+	}
+	key := PrefixUserCacheKey + id
+	update := bson.M{"$set": bson.M{consts.PassWord: hash, "updateAt": time.Now()}}
+	if previous != "" && keep > 0 {
+		update["$push"] = bson.M{consts.PasswordHistory: bson.M{"$each": []string{previous}, "$slice": -keep}}
+	}
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, update)
+	return err
+}
+
+func (m *MongoMapper) FindDuplicateAuths(ctx context.Context) ([]*DuplicateAuth, error) {
+	var data []*DuplicateAuth
+	err := m.conn.Aggregate(ctx, &data, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$" + consts.Auths}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				consts.Type:       "$auths.type",
+				consts.AppId:      "$auths.appId",
+				consts.UnionId:    "$auths.unionId",
+				consts.PlatformId: "$auths.platformId",
+			},
+			"userIds": bson.M{"$addToSet": "$_id"},
+		}}},
+		{{Key: "$match", Value: bson.M{"userIds.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 将仍以明文保存旧默认密码的用户迁移为未设置密码，已被哈希的旧默认密码在登录时迁移
+// 同时删除这些用户的缓存，避免缓存中继续保留旧默认密码
+func (m *MongoMapper) migrateLegacyPassword(ctx context.Context) {
+	filter := bson.M{consts.PassWord: consts.LegacyDefaultPassword}
+	var users []*User
+	if err := m.conn.Find(ctx, &users, filter, options.Find().SetProjection(bson.M{consts.ID: 1})); err != nil {
+		log.Error("查找旧默认密码失败[%v]", err)
+		return
+	}
+	if len(users) == 0 {
+		return
+	}
+	keys := lo.Map(users, func(user *User, _ int) string {
+		return PrefixUserCacheKey + user.ID.Hex()
+	})
+	res, err := m.conn.UpdateMany(ctx, keys, filter, bson.M{"$unset": bson.M{consts.PassWord: ""}})
+	if err != nil {
+		log.Error("迁移旧默认密码失败[%v]", err)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		log.Info("已清除%d个用户的旧默认密码", res.ModifiedCount)
+	}
+}
+
+func (m *MongoMapper) UnsetPassword(ctx context.Context, id string) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{"$unset": bson.M{consts.PassWord: ""}, "$set": bson.M{"updateAt": time.Now()}})
+	return err
+}
+
+// GrantConsent 已有该客户端的授权记录时合并授权范围，否则新增记录
+func (m *MongoMapper) GrantConsent(ctx context.Context, id, clientId string, scopes []string) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	now := time.Now()
+	res, err := m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID, "consents.clientId": clientId}, bson.M{
+		"$addToSet": bson.M{"consents.$.scopes": bson.M{"$each": scopes}},
+		"$set":      bson.M{"consents.$.grantAt": now, "updateAt": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	res, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{
+		"$push": bson.M{consts.Consents: &Consent{ClientId: clientId, Scopes: scopes, GrantAt: now}},
+		"$set":  bson.M{"updateAt": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return consts.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoMapper) SetTOTP(ctx context.Context, id string, totp *TOTP) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	res, err := m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID, consts.TOTPEnabled: bson.M{"$ne": true}}, bson.M{"$set": bson.M{consts.TOTP: totp, "updateAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return consts.ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (m *MongoMapper) EnableTOTP(ctx context.Context, id string, recoveryCodes []string) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	res, err := m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID, consts.TOTPEnabled: false}, bson.M{"$set": bson.M{
+		consts.TOTPEnabled:   true,
+		consts.RecoveryCodes: recoveryCodes,
+		"totp.enableAt":      time.Now(),
+		"updateAt":           time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return consts.ErrTOTPEnabled
+	}
+	return nil
+}
+
+// UseRecoveryCode 原子地移除恢复码，恢复码不存在或已被使用时返回 false
+func (m *MongoMapper) UseRecoveryCode(ctx context.Context, id string, hash string) (bool, error) {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+	key := PrefixUserCacheKey + id
+	res, err := m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID, consts.RecoveryCodes: hash}, bson.M{"$pull": bson.M{consts.RecoveryCodes: hash}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+func (m *MongoMapper) AddPasskey(ctx context.Context, id string, passkey *Passkey, auth *Auth) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	passkey.CreateAt = time.Now()
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, bson.M{
+		"$push": bson.M{consts.Passkeys: passkey, consts.Auths: auth},
+		"$set":  bson.M{"updateAt": time.Now()},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return consts.ErrAuthBound
+	}
+	return err
+}
+
+func (m *MongoMapper) TouchPasskey(ctx context.Context, id, credentialId string, signCount int64) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID, "passkeys.credentialId": credentialId}, bson.M{"$set": bson.M{
+		"passkeys.$.signCount":  signCount,
+		"passkeys.$.lastUsedAt": time.Now(),
+	}})
+	return err
+}
+
+// SetStatus status 为空时清除状态字段，用于恢复没有状态字段的旧数据
+func (m *MongoMapper) SetStatus(ctx context.Context, id string, status *Status) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	update := bson.M{"$set": bson.M{"status": status, "updateAt": time.Now()}}
+	if status == nil {
+		update = bson.M{"$unset": bson.M{"status": ""}, "$set": bson.M{"updateAt": time.Now()}}
+	} else {
+		status.UpdateAt = time.Now()
+	}
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: ID}, update)
+	return err
+}
+
+// RemoveAuth 只在用户至少还有两个授权信息时移除，判断与移除在同一次更新中完成，并发解绑也不会移除最后一个
+func (m *MongoMapper) RemoveAuth(ctx context.Context, id string, auth *Auth) error {
+	ID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	key := PrefixUserCacheKey + id
+	match := bson.M{
+		consts.Type:       auth.Type,
+		consts.AppId:      auth.AppId,
+		consts.UnionId:    auth.UnionId,
+		consts.PlatformId: auth.PlatformId,
+	}
+	pull := bson.M{consts.Auths: match}
+	if auth.Type == consts.PasskeyAuthType {
+		pull[consts.Passkeys] = bson.M{"credentialId": auth.UnionId}
+	}
+	res, err := m.conn.UpdateOne(ctx, key, bson.M{
+		consts.ID:    ID,
+		consts.Auths: bson.M{"$elemMatch": match},
+		"auths.1":    bson.M{"$exists": true},
+	}, bson.M{"$pull": pull, "$set": bson.M{"updateAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	// 未匹配时区分授权信息不存在与只剩一个授权信息
+	user, err := m.FindOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, ok := lo.Find(user.Auths, func(a *Auth) bool {
+		return *a == *auth
+	}); !ok {
+		return consts.ErrNotFound
+	}
+	return consts.ErrLastAuth
 }
 
 func (m *MongoMapper) UpdateById(ctx context.Context, auth *Auth, id string) (*mongo.UpdateResult, error) {
@@ -89,6 +572,39 @@ func (m *MongoMapper) UpdateById(ctx context.Context, auth *Auth, id string) (*m
 	return res, err
 }
 
+// MigrateLegacyAuth 第三方登录改为授权码交换前，授权信息的 appId 与 platformId 由调用方传入，
+// 按 type+unionId 找到与 auth 不一致的旧授权信息并改写为 auth，没有旧授权信息时不做修改；
+// auth 已属于其他用户时返回 ErrAuthBound，旧授权信息保持不变
+func (m *MongoMapper) MigrateLegacyAuth(ctx context.Context, auth *Auth) error {
+	legacy := bson.M{
+		consts.Type:    auth.Type,
+		consts.UnionId: auth.UnionId,
+		"$or": bson.A{
+			bson.M{consts.AppId: bson.M{"$ne": auth.AppId}},
+			bson.M{consts.PlatformId: bson.M{"$ne": auth.PlatformId}},
+		},
+	}
+	var data User
+	err := m.conn.FindOneNoCache(ctx, &data, bson.M{consts.Auths: bson.M{"$elemMatch": legacy}})
+	switch {
+	case errors.Is(err, monc.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	update := bson.M{"$set": bson.M{"auths.$": auth, "updateAt": time.Now()}}
+	// 用户已有新格式的授权信息时只移除旧的，避免同一用户内出现重复
+	if lo.ContainsBy(data.Auths, func(a *Auth) bool { return *a == *auth }) {
+		update = bson.M{"$pull": bson.M{consts.Auths: legacy}, "$set": bson.M{"updateAt": time.Now()}}
+	}
+	key := PrefixUserCacheKey + data.ID.Hex()
+	_, err = m.conn.UpdateOne(ctx, key, bson.M{consts.ID: data.ID, consts.Auths: bson.M{"$elemMatch": legacy}}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return consts.ErrAuthBound
+	}
+	return err
+}
+
 func (m *MongoMapper) FindOneByAuth(ctx context.Context, auth *Auth) (*User, error) {
 	var data User
 	filter := bson.M{
@@ -122,6 +638,9 @@ func (m *MongoMapper) Insert(ctx context.Context, data *User) (string, error) {
 
 	key := PrefixUserCacheKey + data.ID.Hex()
 	ID, err := m.conn.InsertOne(ctx, key, data)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", consts.ErrAuthExist
+	}
 	if err != nil {
 		return "", err
 	}
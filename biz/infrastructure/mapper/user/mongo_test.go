@@ -0,0 +1,158 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const workers = 16
+
+// 依赖本地 Mongo 与 Redis，通过 MONGO_URL 与 REDIS_ADDR 指定，未设置时跳过；每个测试使用独立的库并在结束时删除
+func newTestMapper(t *testing.T) *MongoMapper {
+	t.Helper()
+	url, addr := os.Getenv("MONGO_URL"), os.Getenv("REDIS_ADDR")
+	if url == "" || addr == "" {
+		t.Skip("MONGO_URL or REDIS_ADDR not set")
+	}
+	c := &config.Config{CacheConf: cache.CacheConf{{
+		RedisConf: redis.RedisConf{Host: addr, Type: redis.NodeType, NonBlock: true},
+		Weight:    100,
+	}}}
+	c.Mongo.URL = url
+	c.Mongo.DB = fmt.Sprintf("sts_test_%d", time.Now().UnixNano())
+	m := NewMongoMapper(c).(*MongoMapper)
+	t.Cleanup(func() {
+		if err := m.conn.Database().Drop(context.Background()); err != nil {
+			t.Logf("drop %s: %v", c.Mongo.DB, err)
+		}
+	})
+	if err := m.EnsureAuthIndex(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// 同时并发执行 workers 次 fn，返回成功次数与其余请求的错误
+func race(fn func(i int) error) (int, []error) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		ok    int
+		errs  []error
+		start = make(chan struct{})
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			err := fn(i)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				ok++
+			} else {
+				errs = append(errs, err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return ok, errs
+}
+
+func TestInsertConcurrentSameAuth(t *testing.T) {
+	m := newTestMapper(t)
+	ctx := context.Background()
+	auth := &Auth{Type: consts.EmailAuthType, AppId: "race@example.com"}
+	ok, errs := race(func(int) error {
+		_, err := m.Insert(ctx, &User{Auths: []*Auth{auth}})
+		return err
+	})
+	if ok != 1 {
+		t.Fatalf("%d inserts succeeded, want 1", ok)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, consts.ErrAuthExist) {
+			t.Errorf("got %v, want ErrAuthExist", err)
+		}
+	}
+	if _, err := m.FindOneByAuth(ctx, auth); err != nil {
+		t.Errorf("find inserted user: %v", err)
+	}
+}
+
+func TestAppendAuthConcurrentSameAuth(t *testing.T) {
+	m := newTestMapper(t)
+	ctx := context.Background()
+	ids := make([]string, workers)
+	for i := range ids {
+		id, err := m.Insert(ctx, &User{Auths: []*Auth{{Type: consts.EmailAuthType, AppId: fmt.Sprintf("user%d@example.com", i)}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	auth := &Auth{Type: 2, AppId: "wx-app", UnionId: "race-union-id"}
+	ok, errs := race(func(i int) error {
+		return m.AppendAuth(ctx, ids[i], auth)
+	})
+	if ok != 1 {
+		t.Fatalf("%d appends succeeded, want 1", ok)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, consts.ErrAuthBound) {
+			t.Errorf("got %v, want ErrAuthBound", err)
+		}
+	}
+}
+
+func TestMigrateLegacyAuth(t *testing.T) {
+	m := newTestMapper(t)
+	ctx := context.Background()
+	legacy := &Auth{Type: 2, AppId: "caller-app", UnionId: "legacy-union-id", PlatformId: "web"}
+	id, err := m.Insert(ctx, &User{Auths: []*Auth{legacy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &Auth{Type: 2, AppId: "wx-app", UnionId: "legacy-union-id"}
+	if err = m.MigrateLegacyAuth(ctx, auth); err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.FindOneByAuth(ctx, auth)
+	if err != nil {
+		t.Fatalf("find migrated auth: %v", err)
+	}
+	if user.ID.Hex() != id || len(user.Auths) != 1 {
+		t.Errorf("user=%s, auths=%d", user.ID.Hex(), len(user.Auths))
+	}
+	// 已迁移后再次调用不做修改
+	if err = m.MigrateLegacyAuth(ctx, auth); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新格式的授权信息已属于其他用户时保留旧授权信息
+	other := &Auth{Type: 2, AppId: "caller-app", UnionId: "other-union-id"}
+	if _, err = m.Insert(ctx, &User{Auths: []*Auth{other}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Insert(ctx, &User{Auths: []*Auth{{Type: 2, AppId: "wx-app", UnionId: "other-union-id"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.MigrateLegacyAuth(ctx, &Auth{Type: 2, AppId: "wx-app", UnionId: "other-union-id"}); !errors.Is(err, consts.ErrAuthBound) {
+		t.Errorf("got %v, want ErrAuthBound", err)
+	}
+	if _, err = m.FindOneByAuth(ctx, other); err != nil {
+		t.Errorf("legacy auth should be kept: %v", err)
+	}
+}
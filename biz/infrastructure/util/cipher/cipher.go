@@ -0,0 +1,59 @@
+package cipher
+
+import (
+	"crypto/aes"
+	gocipher "crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+)
+
+var (
+	ErrInvalidMasterKey = errors.New("cipher: master key must be 32 bytes base64 encoded")
+	ErrInvalidData      = errors.New("cipher: invalid ciphertext")
+)
+
+// Cipher 使用主密钥以 AES-256-GCM 加密需要落库的敏感数据
+type Cipher struct {
+	aead gocipher.AEAD
+}
+
+func NewCipher(config *config.Config) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(config.MasterKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidMasterKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := gocipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt 加密并返回 base64 编码的 nonce||ciphertext
+func (c *Cipher) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (c *Cipher) Decrypt(ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return nil, ErrInvalidData
+	}
+	nonce, data := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, ErrInvalidData
+	}
+	return plaintext, nil
+}
@@ -5,10 +5,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
-	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util"
 	"github.com/CloudStriver/go-pkg/utils/pconvertor"
 	"github.com/zeromicro/go-zero/core/trace"
 	oteltrace "go.opentelemetry.io/otel/trace"
+	"html"
 	"log"
 	"net"
 	"net/smtp"
@@ -18,10 +18,42 @@ import (
 
 const (
 	contentType = "text/html; charset=UTF-8"
-	body        = "<body><div class=\"container\"><p>你好，</p><p>你此次{{.subject}}的验证码如下，请在 5 分钟内输入验证码进行下一步操作。如非你本人操作，请忽略此邮件。</p><p><strong>验证码：</strong>{{.code}}</p></div></body><style>body{font-family:Arial,sans-serif;background-color:#f0f0f0;margin:0;padding:0;}.container{max-width:600px;margin:0 auto;padding:20px;background-color:#ffffff;border-radius:5px;box-shadow:0 0 10px rgba(0,0,0,.1);}p{font-size:16px;line-height:1.6;color:#333333;}strong{font-weight:bold;}</style>\n"
+	body        = "<body><div class=\"container\"><p>你好，</p><p>你此次{{.subject}}的验证码如下，请在 {{.ttl}}内输入验证码进行下一步操作。如非你本人操作，请忽略此邮件。</p><p><strong>验证码：</strong>{{.code}}</p></div></body><style>body{font-family:Arial,sans-serif;background-color:#f0f0f0;margin:0;padding:0;}.container{max-width:600px;margin:0 auto;padding:20px;background-color:#ffffff;border-radius:5px;box-shadow:0 0 10px rgba(0,0,0,.1);}p{font-size:16px;line-height:1.6;color:#333333;}strong{font-weight:bold;}</style>\n"
+	loginBody   = "<body><div class=\"container\"><p>你好，</p><p>你正在{{.subject}}，请在 {{.ttl}}内点击下方链接或输入验证码完成登录，链接与验证码只能使用一次。如非你本人操作，请忽略此邮件。</p><p><a href=\"{{.link}}\">点击登录</a></p><p><strong>验证码：</strong>{{.code}}</p></div></body><style>body{font-family:Arial,sans-serif;background-color:#f0f0f0;margin:0;padding:0;}.container{max-width:600px;margin:0 auto;padding:20px;background-color:#ffffff;border-radius:5px;box-shadow:0 0 10px rgba(0,0,0,.1);}p{font-size:16px;line-height:1.6;color:#333333;}strong{font-weight:bold;}</style>\n"
+	changedBody = "<body><div class=\"container\"><p>你好，</p><p>你的账号绑定的邮箱已修改为 {{.email}}，此后将无法使用本邮箱登录。如非你本人操作，请在有效期内撤销修改，撤销后账号的全部登录将退出，密码需要通过本邮箱重新设置。</p>{{.revert}}</div></body><style>body{font-family:Arial,sans-serif;background-color:#f0f0f0;margin:0;padding:0;}.container{max-width:600px;margin:0 auto;padding:20px;background-color:#ffffff;border-radius:5px;box-shadow:0 0 10px rgba(0,0,0,.1);}p{font-size:16px;line-height:1.6;color:#333333;}strong{font-weight:bold;}</style>\n"
 )
 
-func SendEmail(ctx context.Context, EmailConf config.EmailConf, toEmail, subject string) (string, error) {
+// SendEmail 发送验证码邮件，ttl 为验证码有效期
+func SendEmail(ctx context.Context, EmailConf config.EmailConf, toEmail, subject, code string, ttl time.Duration) error {
+	content := strings.NewReplacer("{{.code}}", code, "{{.subject}}", subject, "{{.ttl}}", formatTTL(ttl)).Replace(body)
+	return send(ctx, EmailConf, toEmail, subject, content)
+}
+
+// SendLoginEmail 发送包含登录链接与验证码的邮件
+func SendLoginEmail(ctx context.Context, EmailConf config.EmailConf, toEmail, subject, code, link string, ttl time.Duration) error {
+	content := strings.NewReplacer("{{.code}}", code, "{{.subject}}", subject, "{{.link}}", html.EscapeString(link), "{{.ttl}}", formatTTL(ttl)).Replace(loginBody)
+	return send(ctx, EmailConf, toEmail, subject, content)
+}
+
+// 有效期为整分钟时按分钟显示，否则按秒显示
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Minute && ttl%time.Minute == 0 {
+		return fmt.Sprintf("%d 分钟", ttl/time.Minute)
+	}
+	return fmt.Sprintf("%d 秒", ttl/time.Second)
+}
+
+// SendEmailChangedEmail 通知旧邮箱绑定邮箱已修改，link 为空时只附带撤销令牌
+func SendEmailChangedEmail(ctx context.Context, EmailConf config.EmailConf, toEmail, subject, newEmail, token, link string) error {
+	revert := "<p><strong>撤销令牌：</strong>" + token + "</p>"
+	if link != "" {
+		revert = "<p><a href=\"" + html.EscapeString(link) + "\">撤销修改</a></p>"
+	}
+	content := strings.NewReplacer("{{.email}}", html.EscapeString(newEmail), "{{.revert}}", revert).Replace(changedBody)
+	return send(ctx, EmailConf, toEmail, subject, content)
+}
+
+func send(ctx context.Context, EmailConf config.EmailConf, toEmail, subject, content string) error {
 	_, span := trace.TracerFromContext(ctx).Start(ctx, "auth.SendEmail", oteltrace.WithTimestamp(time.Now()), oteltrace.WithSpanKind(oteltrace.SpanKindClient))
 	defer func() {
 		span.End(oteltrace.WithTimestamp(time.Now()))
@@ -32,10 +64,9 @@ func SendEmail(ctx context.Context, EmailConf config.EmailConf, toEmail, subject
 	header["Subject"] = subject
 	header["Content-Type"] = contentType
 
-	Code := util.GenerateCode()
-	message := buildMessage(header, strings.Replace(strings.Replace(body, "{{.code}}", Code, 1), "{{.subject}}", subject, 1))
+	message := buildMessage(header, content)
 	auth := smtp.PlainAuth("", EmailConf.Email, EmailConf.Password, EmailConf.Host)
-	return Code, SendMailWithTLS(fmt.Sprintf("%s:%d", EmailConf.Host, EmailConf.Port), auth, EmailConf.Email, []string{toEmail}, pconvertor.String2Bytes(message))
+	return SendMailWithTLS(fmt.Sprintf("%s:%d", EmailConf.Host, EmailConf.Port), auth, EmailConf.Email, []string{toEmail}, pconvertor.String2Bytes(message))
 }
 
 func buildMessage(header map[string]string, body string) string {
@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrMalformed        = errors.New("jwt: malformed token")
+	ErrUnsupportedAlg   = errors.New("jwt: unsupported algorithm")
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	ErrInvalidKey       = errors.New("jwt: invalid key")
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Sign 生成紧凑格式的 JWS，key 为 HS256 的 []byte 或对应算法的私钥
+func Sign(header *Header, claims any, key any) (string, error) {
+	if header.Typ == "" {
+		header.Typ = "JWT"
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sig, err := sign(header.Alg, []byte(signingInput), key)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Parse 校验签名并解析载荷，keyFunc 根据头部返回校验用的密钥，时间相关的声明由调用方校验
+func Parse(token string, claims any, keyFunc func(header *Header) (any, error)) (*Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	h, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	header := new(Header)
+	if err = json.Unmarshal(h, header); err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := keyFunc(header)
+	if err != nil {
+		return nil, err
+	}
+	if err = verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig, key); err != nil {
+		return nil, err
+	}
+	c, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err = json.Unmarshal(c, claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return header, nil
+}
+
+func sign(alg string, input []byte, key any) ([]byte, error) {
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case ES256:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS 要求 r||s 定长拼接
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case EdDSA:
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.Sign(priv, input), nil
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+}
+
+func verify(alg string, input, sig []byte, key any) error {
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrInvalidKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(input)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		digest := sha256.Sum256(input)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		digest := sha256.Sum256(input)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case EdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		if !ed25519.Verify(pub, input, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrUnsupportedAlg
+	}
+}
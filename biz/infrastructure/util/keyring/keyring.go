@@ -0,0 +1,363 @@
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	keymapper "github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/key"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/cipher"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/jwt"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/log"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"github.com/zeromicro/go-zero/core/threading"
+)
+
+var ErrNoSigningKey = errors.New("keyring: no active signing key")
+
+const (
+	// 生成密钥的分布式锁，保证多个副本中只有一个生成新密钥
+	generateLock       = "SigningKeyGenerate"
+	generateLockExpire = 30
+	// 未取得锁的副本等待其他副本生成密钥的重试次数与间隔
+	waitRetries  = 10
+	waitInterval = 500 * time.Millisecond
+	// 遇到未知 kid 时重新加载密钥的最小间隔，避免伪造的 kid 触发大量查询
+	reloadInterval = time.Second
+)
+
+// Key 已解密的签名密钥
+type Key struct {
+	Kid        string
+	Algorithm  string
+	Signer     crypto.Signer
+	Public     crypto.PublicKey
+	ActivateAt time.Time
+	RetireAt   time.Time
+	ExpireAt   time.Time
+}
+
+// Keyring 管理签名密钥的轮换：密钥加密保存在 Mongo，按周期生成新密钥，停用的密钥在宽限期内仍可验签
+type Keyring struct {
+	redis  *redis.Redis
+	mapper keymapper.IKeyMongoMapper
+	cipher *cipher.Cipher
+	conf   config.KeyConf
+
+	mu   sync.RWMutex
+	keys []*Key
+
+	reloadMu sync.Mutex
+	reloadAt time.Time
+}
+
+func NewKeyring(config *config.Config, redis *redis.Redis, mapper keymapper.IKeyMongoMapper, cipher *cipher.Cipher) (*Keyring, error) {
+	k := &Keyring{
+		redis:  redis,
+		mapper: mapper,
+		cipher: cipher,
+		conf:   config.KeyConf,
+	}
+	if err := k.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	threading.GoSafe(k.run)
+	return k, nil
+}
+
+// SigningKey 返回当前用于签名的密钥，多个密钥同时生效时使用最新启用的一个
+func (k *Keyring) SigningKey() (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	var current *Key
+	for _, key := range k.keys {
+		if !key.ActivateAt.After(now) && now.Before(key.RetireAt) {
+			if current == nil || key.ActivateAt.After(current.ActivateAt) {
+				current = key
+			}
+		}
+	}
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	return current, nil
+}
+
+// VerificationKey 按 kid 查找仍在验签有效期内的密钥
+// 找不到时重新加载一次，其他副本刚生成的密钥在下次定时刷新前也能验签
+func (k *Keyring) VerificationKey(kid string) (*Key, bool) {
+	if key, ok := k.findKey(kid); ok {
+		return key, true
+	}
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+	if key, ok := k.findKey(kid); ok {
+		return key, true
+	}
+	if time.Since(k.reloadAt) < reloadInterval {
+		return nil, false
+	}
+	k.reloadAt = time.Now()
+	keys, err := k.load(context.Background())
+	if err != nil {
+		log.Error("重新加载签名密钥失败[%v]", err)
+		return nil, false
+	}
+	k.setKeys(keys)
+	return k.findKey(kid)
+}
+
+func (k *Keyring) findKey(kid string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.Kid == kid && now.Before(key.ExpireAt) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS 返回所有可用于验签的公钥，包括已提前发布但尚未启用的密钥
+func (k *Keyring) JWKS() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	keys := make([]*jwk, 0, len(k.keys))
+	for _, key := range k.keys {
+		if !now.Before(key.ExpireAt) {
+			continue
+		}
+		j := &jwk{Use: "sig", Alg: key.Algorithm, Kid: key.Kid}
+		switch pub := key.Public.(type) {
+		case *ecdsa.PublicKey:
+			j.Kty, j.Crv = "EC", "P-256"
+			x, y := make([]byte, 32), make([]byte, 32)
+			pub.X.FillBytes(x)
+			pub.Y.FillBytes(y)
+			j.X, j.Y = base64.RawURLEncoding.EncodeToString(x), base64.RawURLEncoding.EncodeToString(y)
+		case *rsa.PublicKey:
+			j.Kty = "RSA"
+			j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			j.Kty, j.Crv = "OKP", "Ed25519"
+			j.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, j)
+	}
+	return json.Marshal(map[string]any{"keys": keys})
+}
+
+func (k *Keyring) run() {
+	ticker := time.NewTicker(time.Duration(k.conf.RefreshInterval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := k.refresh(context.Background()); err != nil {
+			log.Error("刷新签名密钥失败[%v]", err)
+		}
+	}
+}
+
+// 重新加载密钥，必要时生成并提前发布下一个密钥
+// 生成在分布式锁内进行，取得锁后重新加载确认仍需生成，未取得锁的副本等待持有锁的副本生成
+func (k *Keyring) refresh(ctx context.Context) error {
+	keys, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := k.nextActivation(keys); !ok {
+		k.setKeys(keys)
+		return nil
+	}
+
+	lock := redis.NewRedisLock(k.redis, generateLock)
+	lock.SetExpire(generateLockExpire)
+	acquired, err := lock.AcquireCtx(ctx)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return k.waitForKey(ctx, keys)
+	}
+	defer func() {
+		if _, err := lock.ReleaseCtx(ctx); err != nil {
+			log.Error("释放签名密钥生成锁失败[%v]", err)
+		}
+	}()
+
+	if keys, err = k.load(ctx); err != nil {
+		return err
+	}
+	if activateAt, ok := k.nextActivation(keys); ok {
+		next, err := k.generate(ctx, activateAt)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, next)
+	}
+	k.setKeys(keys)
+	return nil
+}
+
+// 返回需要生成的下一个密钥的启用时间：没有可签名的密钥时立即启用，当前密钥临近停用时在其停用时启用
+func (k *Keyring) nextActivation(keys []*Key) (time.Time, bool) {
+	now := time.Now()
+	var latest *Key
+	for _, key := range keys {
+		if latest == nil || key.RetireAt.After(latest.RetireAt) {
+			latest = key
+		}
+	}
+	switch {
+	case latest == nil || !latest.RetireAt.After(now):
+		return now, true
+	case latest.RetireAt.Sub(now) <= time.Duration(k.conf.PrePublish)*time.Second:
+		return latest.RetireAt, true
+	}
+	return time.Time{}, false
+}
+
+// 其他副本正在生成密钥，已有可签名的密钥时直接使用，否则等待新密钥写入
+func (k *Keyring) waitForKey(ctx context.Context, keys []*Key) error {
+	k.setKeys(keys)
+	if _, err := k.SigningKey(); err == nil {
+		return nil
+	}
+	for i := 0; i < waitRetries; i++ {
+		time.Sleep(waitInterval)
+		keys, err := k.load(ctx)
+		if err != nil {
+			return err
+		}
+		k.setKeys(keys)
+		if _, err = k.SigningKey(); err == nil {
+			return nil
+		}
+	}
+	return ErrNoSigningKey
+}
+
+func (k *Keyring) setKeys(keys []*Key) {
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+}
+
+func (k *Keyring) load(ctx context.Context) ([]*Key, error) {
+	data, err := k.mapper.FindValid(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(data))
+	for _, d := range data {
+		der, err := k.cipher.Decrypt(d.PrivateKey)
+		if err != nil {
+			log.Error("解密签名密钥失败[%v], kid=%s", err, d.Kid)
+			continue
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			log.Error("解析签名密钥失败[%v], kid=%s", err, d.Kid)
+			continue
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		keys = append(keys, &Key{
+			Kid:        d.Kid,
+			Algorithm:  d.Algorithm,
+			Signer:     signer,
+			Public:     signer.Public(),
+			ActivateAt: d.ActivateAt,
+			RetireAt:   d.RetireAt,
+			ExpireAt:   d.ExpireAt,
+		})
+	}
+	return keys, nil
+}
+
+// 生成自 activateAt 起用于签名的新密钥并加密保存
+func (k *Keyring) generate(ctx context.Context, activateAt time.Time) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch k.conf.Algorithm {
+	case jwt.RS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.EdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := k.cipher.Encrypt(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err = rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Kid:        base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:  k.conf.Algorithm,
+		Signer:     signer,
+		Public:     signer.Public(),
+		ActivateAt: activateAt,
+		RetireAt:   activateAt.Add(time.Duration(k.conf.RotationPeriod) * time.Second),
+	}
+	key.ExpireAt = key.RetireAt.Add(time.Duration(k.conf.GracePeriod) * time.Second)
+	if _, err = k.mapper.Insert(ctx, &keymapper.SigningKey{
+		Kid:        key.Kid,
+		Algorithm:  key.Algorithm,
+		PrivateKey: encrypted,
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		ActivateAt: key.ActivateAt,
+		RetireAt:   key.RetireAt,
+		ExpireAt:   key.ExpireAt,
+	}); err != nil {
+		return nil, err
+	}
+	log.Info("已生成签名密钥, kid=%s, activateAt=%s", key.Kid, key.ActivateAt.Format(time.RFC3339))
+	return key, nil
+}
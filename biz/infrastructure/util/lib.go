@@ -1,13 +0,0 @@
-package util
-
-import (
-	"fmt"
-	"math/rand"
-	"time"
-)
-
-func GenerateCode() string {
-	rand.Seed(time.Now().UnixNano())
-	code := fmt.Sprintf("%06d", rand.Intn(1000000))
-	return code
-}
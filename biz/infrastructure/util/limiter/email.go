@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const day = 24 * 60 * 60
+
+// KEYS: 冷却键、收件人额度键、IP额度键（可省略）
+// ARGV: 冷却时间、收件人每日额度、IP每日额度、距零点的秒数
+// 先检查全部限制，都未超出时才一并占用，返回 0 表示成功，-1 表示超出每日额度，正数为剩余冷却时间
+var takeScript = redis.NewScript(`
+local ttl = redis.call('TTL', KEYS[1])
+if ttl > 0 then
+	return ttl
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 1
+end
+if tonumber(redis.call('GET', KEYS[2]) or '0') >= tonumber(ARGV[2]) then
+	return -1
+end
+if KEYS[3] and tonumber(redis.call('GET', KEYS[3]) or '0') >= tonumber(ARGV[3]) then
+	return -1
+end
+redis.call('SET', KEYS[1], 1, 'EX', ARGV[1])
+for i = 2, #KEYS do
+	if redis.call('INCR', KEYS[i]) == 1 then
+		redis.call('EXPIRE', KEYS[i], ARGV[4])
+	end
+end
+return 0
+`)
+
+// EmailLimiter 限制验证码邮件的发送频率：同一收件人的冷却时间、收件人与调用方IP的每日额度
+type EmailLimiter struct {
+	redis *redis.Redis
+	conf  config.EmailLimitConf
+}
+
+func NewEmailLimiter(config *config.Config, redis *redis.Redis) *EmailLimiter {
+	return &EmailLimiter{
+		redis: redis,
+		conf:  config.EmailLimitConf,
+	}
+}
+
+// Take 占用一次发送额度，超出限制时返回带 RetryInfo 的错误且不占用任何额度，ip 为空时不做IP限制
+func (l *EmailLimiter) Take(ctx context.Context, email, ip string) error {
+	keys := []string{
+		fmt.Sprintf("%s:%s", consts.EmailCooldown, email),
+		fmt.Sprintf("%s:%s", consts.EmailQuota, email),
+	}
+	if ip != "" {
+		keys = append(keys, fmt.Sprintf("%s:%s", consts.EmailIpQuota, ip))
+	}
+	reset := untilTomorrow()
+	res, err := l.redis.ScriptRunCtx(ctx, takeScript, keys,
+		l.conf.Cooldown, l.conf.RecipientDailyQuota, l.conf.IpDailyQuota, int64(reset/time.Second))
+	if err != nil {
+		return err
+	}
+	switch code, _ := res.(int64); {
+	case code > 0:
+		return consts.RetryAfter(consts.ErrSendTooFrequent, time.Duration(code)*time.Second)
+	case code < 0:
+		return consts.RetryAfter(consts.ErrSendOverQuota, reset)
+	}
+	return nil
+}
+
+// 距本地时区下一个零点的时长，每日额度在此时重置
+func untilTomorrow() time.Duration {
+	now := time.Now()
+	_, offset := now.Zone()
+	return time.Duration(day-(now.Unix()+int64(offset))%day) * time.Second
+}
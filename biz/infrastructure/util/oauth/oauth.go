@@ -0,0 +1,198 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+)
+
+var (
+	ErrExchange   = errors.New("oauth: authorization code exchange failed")
+	ErrNoUnionId  = errors.New("oauth: provider returned no user identifier")
+	ErrBadConfig  = errors.New("oauth: invalid provider config")
+	ErrBadRequest = errors.New("oauth: provider request failed")
+)
+
+const (
+	TypeOAuth2 = "oauth2"
+	TypeGithub = "github"
+	TypeWechat = "wechat"
+	TypeQQ     = "qq"
+)
+
+// 各提供方的官方端点，配置中未指定时使用
+var defaultEndpoints = map[string][2]string{
+	TypeGithub: {"https://github.com/login/oauth/access_token", "https://api.github.com/user"},
+	TypeWechat: {"https://api.weixin.qq.com/sns/oauth2/access_token", "https://api.weixin.qq.com/sns/userinfo"},
+	TypeQQ:     {"https://graph.qq.com/oauth2.0/token", "https://graph.qq.com/oauth2.0/me"},
+}
+
+// 响应体大小上限，避免异常的提供方占用过多内存
+const maxBodySize = 1 << 20
+
+// Identity 授权码交换得到的用户身份，UnionId 在同一提供方下稳定不变
+type Identity struct {
+	UnionId string
+	OpenId  string
+}
+
+type exchanger interface {
+	exchange(ctx context.Context, code, redirectURI string) (*Identity, error)
+}
+
+// Provider 一个已配置的第三方登录提供方
+type Provider struct {
+	Name     string
+	AuthType int64
+	AppId    string
+	conf     config.OAuthProviderConf
+	exchanger
+}
+
+// Exchange 用授权码向提供方换取用户身份，redirectURI 为空时使用配置的回调地址
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI string) (*Identity, error) {
+	if code == "" {
+		return nil, ErrExchange
+	}
+	if redirectURI == "" {
+		redirectURI = p.conf.RedirectURL
+	}
+	return p.exchange(ctx, code, redirectURI)
+}
+
+// Registry 按名称与登录方式索引已配置的提供方
+type Registry struct {
+	byName     map[string]*Provider
+	byAuthType map[int64]*Provider
+}
+
+func NewRegistry(config *config.Config) (*Registry, error) {
+	r := &Registry{
+		byName:     make(map[string]*Provider),
+		byAuthType: make(map[int64]*Provider),
+	}
+	for _, conf := range config.OAuthConf.Providers {
+		p, err := newProvider(conf)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.byName[p.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrBadConfig, p.Name)
+		}
+		if _, ok := r.byAuthType[p.AuthType]; ok {
+			return nil, fmt.Errorf("%w: duplicate auth type %d", ErrBadConfig, p.AuthType)
+		}
+		r.byName[p.Name] = p
+		r.byAuthType[p.AuthType] = p
+	}
+	return r, nil
+}
+
+// Get 按名称查找提供方
+func (r *Registry) Get(name string) (*Provider, bool) {
+	p, ok := r.byName[name]
+	return p, ok
+}
+
+// ByAuthType 按登录方式查找提供方，找到说明该登录方式的身份必须由授权码交换得到
+func (r *Registry) ByAuthType(authType int64) (*Provider, bool) {
+	p, ok := r.byAuthType[authType]
+	return p, ok
+}
+
+func newProvider(conf config.OAuthProviderConf) (*Provider, error) {
+	if conf.Name == "" || conf.AuthType <= 0 || conf.ClientId == "" {
+		return nil, fmt.Errorf("%w: name, authType and clientId are required", ErrBadConfig)
+	}
+	if name, ok := consts.ReservedAuthTypes[conf.AuthType]; ok {
+		return nil, fmt.Errorf("%w: auth type %d is reserved for %s", ErrBadConfig, conf.AuthType, name)
+	}
+	if conf.Type == "" {
+		conf.Type = TypeOAuth2
+	}
+	if endpoints, ok := defaultEndpoints[conf.Type]; ok {
+		if conf.TokenURL == "" {
+			conf.TokenURL = endpoints[0]
+		}
+		if conf.UserInfoURL == "" {
+			conf.UserInfoURL = endpoints[1]
+		}
+	}
+	if conf.TokenURL == "" || conf.UserInfoURL == "" {
+		return nil, fmt.Errorf("%w: %s requires tokenURL and userInfoURL", ErrBadConfig, conf.Name)
+	}
+	if conf.UnionIdField == "" {
+		conf.UnionIdField = "sub"
+		if conf.Type == TypeGithub {
+			conf.UnionIdField = "id"
+		}
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10
+	}
+	if conf.AppId == "" {
+		conf.AppId = conf.ClientId
+	}
+
+	c := &client{conf: conf, http: &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second}}
+	p := &Provider{
+		Name:     conf.Name,
+		AuthType: conf.AuthType,
+		AppId:    conf.AppId,
+		conf:     conf,
+	}
+	switch conf.Type {
+	case TypeOAuth2, TypeGithub:
+		p.exchanger = &oauth2Exchanger{c}
+	case TypeWechat:
+		p.exchanger = &wechatExchanger{c}
+	case TypeQQ:
+		p.exchanger = &qqExchanger{c}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrBadConfig, conf.Type)
+	}
+	return p, nil
+}
+
+type client struct {
+	conf config.OAuthProviderConf
+	http *http.Client
+}
+
+// doJSON 发送请求并解析 JSON 响应，数字按 json.Number 保留原始精度
+func (c *client) doJSON(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s returned %d", ErrBadRequest, req.URL.Path, resp.StatusCode)
+	}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize))
+	decoder.UseNumber()
+	if err = decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	return nil
+}
+
+// stringify 将用户信息中的标识字段转为字符串，github 等提供方的 id 为数字
+func stringify(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,174 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// oauth2Exchanger 标准授权码流程：POST 令牌端点换取访问令牌，再以 Bearer 令牌读取用户信息
+type oauth2Exchanger struct {
+	*client
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	Error            any    `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (e *oauth2Exchanger) exchange(ctx context.Context, code, redirectURI string) (*Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {e.conf.ClientId},
+		"client_secret": {e.conf.ClientSecret},
+	}
+	if redirectURI != "" {
+		form.Set("redirect_uri", redirectURI)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := new(tokenResponse)
+	if err = e.doJSON(req, token); err != nil {
+		return nil, err
+	}
+	// github 在授权码无效时仍返回 200，错误放在 error 字段中
+	if token.Error != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: %v %s", ErrExchange, token.Error, token.ErrorDescription)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, e.conf.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	user := make(map[string]any)
+	if err = e.doJSON(req, &user); err != nil {
+		return nil, err
+	}
+	unionId := stringify(user[e.conf.UnionIdField])
+	if unionId == "" {
+		return nil, ErrNoUnionId
+	}
+	return &Identity{UnionId: unionId, OpenId: unionId}, nil
+}
+
+// wechatExchanger 微信网页授权，令牌接口为 GET 请求，错误通过 errcode 返回
+type wechatExchanger struct {
+	*client
+}
+
+type wechatResponse struct {
+	AccessToken string `json:"access_token"`
+	OpenId      string `json:"openid"`
+	UnionId     string `json:"unionid"`
+	ErrCode     int    `json:"errcode"`
+	ErrMsg      string `json:"errmsg"`
+}
+
+func (e *wechatExchanger) exchange(ctx context.Context, code, _ string) (*Identity, error) {
+	token := new(wechatResponse)
+	if err := e.get(ctx, e.conf.TokenURL, url.Values{
+		"appid":      {e.conf.ClientId},
+		"secret":     {e.conf.ClientSecret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}, token); err != nil {
+		return nil, err
+	}
+	if token.ErrCode != 0 || token.AccessToken == "" || token.OpenId == "" {
+		return nil, fmt.Errorf("%w: %d %s", ErrExchange, token.ErrCode, token.ErrMsg)
+	}
+	// snsapi_base 授权时令牌接口不返回 unionid，需要再查询用户信息
+	if token.UnionId == "" {
+		user := new(wechatResponse)
+		if err := e.get(ctx, e.conf.UserInfoURL, url.Values{
+			"access_token": {token.AccessToken},
+			"openid":       {token.OpenId},
+		}, user); err != nil {
+			return nil, err
+		}
+		if user.ErrCode != 0 {
+			return nil, fmt.Errorf("%w: %d %s", ErrExchange, user.ErrCode, user.ErrMsg)
+		}
+		token.UnionId = user.UnionId
+	}
+	// 未绑定开放平台的应用没有 unionid，openid 只在单个应用内唯一，不能作为跨应用稳定的身份
+	if token.UnionId == "" {
+		return nil, ErrNoUnionId
+	}
+	return &Identity{UnionId: token.UnionId, OpenId: token.OpenId}, nil
+}
+
+// qqExchanger QQ 互联，令牌接口只返回访问令牌，openid 与 unionid 需要通过 /oauth2.0/me 查询
+type qqExchanger struct {
+	*client
+}
+
+type qqMeResponse struct {
+	ClientId         string `json:"client_id"`
+	OpenId           string `json:"openid"`
+	UnionId          string `json:"unionid"`
+	Error            any    `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (e *qqExchanger) exchange(ctx context.Context, code, redirectURI string) (*Identity, error) {
+	token := new(tokenResponse)
+	if err := e.get(ctx, e.conf.TokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {e.conf.ClientId},
+		"client_secret": {e.conf.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"fmt":           {"json"},
+	}, token); err != nil {
+		return nil, err
+	}
+	if token.Error != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: %v %s", ErrExchange, token.Error, token.ErrorDescription)
+	}
+
+	me := new(qqMeResponse)
+	if err := e.get(ctx, e.conf.UserInfoURL, url.Values{
+		"access_token": {token.AccessToken},
+		"unionid":      {"1"},
+		"fmt":          {"json"},
+	}, me); err != nil {
+		return nil, err
+	}
+	if me.Error != nil || me.OpenId == "" {
+		return nil, fmt.Errorf("%w: %v %s", ErrExchange, me.Error, me.ErrorDescription)
+	}
+	// 访问令牌必须是签发给本应用的，防止使用其他应用的令牌冒充
+	if me.ClientId != e.conf.ClientId {
+		return nil, fmt.Errorf("%w: token issued to another client", ErrExchange)
+	}
+	if me.UnionId == "" {
+		return nil, ErrNoUnionId
+	}
+	return &Identity{UnionId: me.UnionId, OpenId: me.OpenId}, nil
+}
+
+func (c *client) get(ctx context.Context, endpoint string, query url.Values, v any) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadConfig, err)
+	}
+	q := u.Query()
+	for k, vs := range query {
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, v)
+}
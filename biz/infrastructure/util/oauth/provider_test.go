@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+)
+
+// fakeProvider 模拟提供方的令牌端点与用户信息端点，token 与 user 为两个端点返回的 JSON
+type fakeProvider struct {
+	t      *testing.T
+	token  any
+	user   any
+	status int
+	// 令牌端点收到的请求参数
+	form map[string]string
+}
+
+func (f *fakeProvider) serve(conf config.OAuthProviderConf) *Provider {
+	f.t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			f.t.Errorf("parse form: %v", err)
+		}
+		f.form = make(map[string]string)
+		for k := range r.Form {
+			f.form[k] = r.Form.Get(k)
+		}
+		f.write(w, f.token)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		f.write(w, f.user)
+	})
+	srv := httptest.NewServer(mux)
+	f.t.Cleanup(srv.Close)
+
+	conf.Name = "fake"
+	conf.AuthType = 10
+	conf.ClientId = "client-id"
+	conf.ClientSecret = "client-secret"
+	conf.TokenURL = srv.URL + "/token"
+	conf.UserInfoURL = srv.URL + "/user"
+	p, err := newProvider(conf)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return p
+}
+
+func (f *fakeProvider) write(w http.ResponseWriter, v any) {
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+	if s, ok := v.(string); ok {
+		_, _ = w.Write([]byte(s))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOAuth2Exchange(t *testing.T) {
+	f := &fakeProvider{t: t, token: map[string]any{"access_token": "at"}, user: map[string]any{"sub": "user-1"}}
+	p := f.serve(config.OAuthProviderConf{Type: TypeOAuth2, RedirectURL: "https://app/callback"})
+	identity, err := p.Exchange(context.Background(), "code-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UnionId != "user-1" {
+		t.Errorf("unionId=%q", identity.UnionId)
+	}
+	for k, want := range map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "code-1",
+		"client_id":     "client-id",
+		"client_secret": "client-secret",
+		"redirect_uri":  "https://app/callback",
+	} {
+		if f.form[k] != want {
+			t.Errorf("%s=%q, want %q", k, f.form[k], want)
+		}
+	}
+}
+
+// github 的用户 id 为数字，需保留完整精度；授权码无效时仍返回 200
+func TestGithubExchange(t *testing.T) {
+	f := &fakeProvider{t: t, token: map[string]any{"access_token": "at"}, user: `{"id": 12345678901234567890}`}
+	p := f.serve(config.OAuthProviderConf{Type: TypeGithub})
+	identity, err := p.Exchange(context.Background(), "code", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UnionId != "12345678901234567890" {
+		t.Errorf("unionId=%q", identity.UnionId)
+	}
+
+	f.token = map[string]any{"error": "bad_verification_code"}
+	if _, err = p.Exchange(context.Background(), "code", ""); !errors.Is(err, ErrExchange) {
+		t.Errorf("got %v, want ErrExchange", err)
+	}
+}
+
+func TestWechatExchange(t *testing.T) {
+	cases := []struct {
+		name  string
+		token any
+		user  any
+		want  string
+		err   error
+	}{
+		{"unionid in token", map[string]any{"access_token": "at", "openid": "o1", "unionid": "u1"}, nil, "u1", nil},
+		{"unionid from userinfo", map[string]any{"access_token": "at", "openid": "o1"}, map[string]any{"openid": "o1", "unionid": "u1"}, "u1", nil},
+		// 没有 unionid 时不能退化为 openid
+		{"no unionid", map[string]any{"access_token": "at", "openid": "o1"}, map[string]any{"openid": "o1"}, "", ErrNoUnionId},
+		{"token errcode", map[string]any{"errcode": 40029, "errmsg": "invalid code"}, nil, "", ErrExchange},
+		{"userinfo errcode", map[string]any{"access_token": "at", "openid": "o1"}, map[string]any{"errcode": 40003}, "", ErrExchange},
+	}
+	for _, c := range cases {
+		f := &fakeProvider{t: t, token: c.token, user: c.user}
+		p := f.serve(config.OAuthProviderConf{Type: TypeWechat})
+		identity, err := p.Exchange(context.Background(), "code", "")
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err == nil && identity.UnionId != c.want {
+			t.Errorf("%s: unionId=%q, want %q", c.name, identity.UnionId, c.want)
+		}
+	}
+}
+
+func TestQQExchange(t *testing.T) {
+	token := map[string]any{"access_token": "at"}
+	cases := []struct {
+		name string
+		me   any
+		want string
+		err  error
+	}{
+		{"ok", map[string]any{"client_id": "client-id", "openid": "o1", "unionid": "u1"}, "u1", nil},
+		{"token of another client", map[string]any{"client_id": "other", "openid": "o1", "unionid": "u1"}, "", ErrExchange},
+		{"no unionid", map[string]any{"client_id": "client-id", "openid": "o1"}, "", ErrNoUnionId},
+		{"error", map[string]any{"error": 100016, "error_description": "access token check failed"}, "", ErrExchange},
+	}
+	for _, c := range cases {
+		f := &fakeProvider{t: t, token: token, user: c.me}
+		p := f.serve(config.OAuthProviderConf{Type: TypeQQ})
+		identity, err := p.Exchange(context.Background(), "code", "https://app/callback")
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err == nil && identity.UnionId != c.want {
+			t.Errorf("%s: unionId=%q, want %q", c.name, identity.UnionId, c.want)
+		}
+	}
+}
+
+func TestExchangeProviderFailure(t *testing.T) {
+	f := &fakeProvider{t: t, token: "not json"}
+	p := f.serve(config.OAuthProviderConf{Type: TypeOAuth2})
+	if _, err := p.Exchange(context.Background(), "code", ""); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("malformed body: got %v, want ErrBadRequest", err)
+	}
+	f.status = http.StatusBadGateway
+	if _, err := p.Exchange(context.Background(), "code", ""); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("non-2xx status: got %v, want ErrBadRequest", err)
+	}
+	if _, err := p.Exchange(context.Background(), "", ""); !errors.Is(err, ErrExchange) {
+		t.Errorf("empty code: got %v, want ErrExchange", err)
+	}
+}
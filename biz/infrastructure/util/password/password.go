@@ -0,0 +1,151 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/samber/lo"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrInvalidHash = errors.New("password: invalid encoded hash")
+
+// Hasher 按PHC格式编码密码哈希，编码串中携带算法与参数，调整参数无需迁移旧数据
+type Hasher struct {
+	conf config.PasswordConf
+
+	once  sync.Once
+	dummy string
+}
+
+func NewHasher(config *config.Config) *Hasher {
+	return &Hasher{conf: config.PasswordConf}
+}
+
+// Hash 使用当前配置的算法与参数哈希密码
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.conf.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.conf.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.conf.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.conf.Iterations, h.conf.Memory, h.conf.Parallelism, h.conf.KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, h.conf.Memory, h.conf.Iterations, h.conf.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyDummy 对不存在或未设置密码的账号执行一次代价相同的校验，避免通过响应时间判断账号是否存在
+func (h *Hasher) VerifyDummy(password string) {
+	h.once.Do(func() {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return
+		}
+		h.dummy, _ = h.Hash(base64.RawStdEncoding.EncodeToString(secret))
+	})
+	_, _, _ = h.Verify(password, h.dummy)
+}
+
+// Verify 校验密码，rehash 表示参数已过时或仍为明文，调用方应在校验通过后重新哈希保存
+func (h *Hasher) Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	if p, err := decodeArgon2id(encoded); err == nil {
+		key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+		ok = subtle.ConstantTimeCompare(key, p.key) == 1
+		return ok, ok && h.argon2idOutdated(p), nil
+	}
+	if !isBcrypt(encoded) {
+		// 旧版本以明文保存的密码，校验通过后重新哈希
+		ok = subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+		return ok, ok, nil
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch {
+	case err == nil:
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.conf.Algorithm != Bcrypt || cost != h.conf.BcryptCost, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, false, nil
+	default:
+		return false, false, err
+	}
+}
+
+// IsPlaintext 判断存储值是否为未哈希的旧明文密码，只有能完整解析的 argon2id 或 bcrypt 编码才视为哈希，以 $ 开头的明文同样是明文
+func IsPlaintext(encoded string) bool {
+	_, err := decodeArgon2id(encoded)
+	return err != nil && !isBcrypt(encoded)
+}
+
+// bcrypt 编码固定为 60 个字符，如 $2b$12$ 后接 22 个字符的盐与 31 个字符的哈希
+func isBcrypt(encoded string) bool {
+	if len(encoded) != 60 || !lo.ContainsBy([]string{"$2a$", "$2b$", "$2y$"}, func(prefix string) bool {
+		return strings.HasPrefix(encoded, prefix)
+	}) {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(encoded))
+	return err == nil
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	// $argon2id$v=19$m=65536,t=3,p=2$salt$key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Argon2id {
+		return nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidHash
+	}
+	p := new(argon2idParams)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, ErrInvalidHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
+
+func (h *Hasher) argon2idOutdated(p *argon2idParams) bool {
+	return h.conf.Algorithm != Argon2id ||
+		p.memory != h.conf.Memory ||
+		p.iterations != h.conf.Iterations ||
+		p.parallelism != h.conf.Parallelism ||
+		uint32(len(p.salt)) != h.conf.SaltLength ||
+		uint32(len(p.key)) != h.conf.KeyLength
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试使用较小的参数以缩短耗时
+func newHasher(algorithm string) *Hasher {
+	return NewHasher(&config.Config{PasswordConf: config.PasswordConf{
+		Algorithm:   algorithm,
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+		BcryptCost:  bcrypt.MinCost,
+	}})
+}
+
+func TestVerify(t *testing.T) {
+	argon := newHasher(Argon2id)
+	argonHash, err := argon.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := newHasher(Bcrypt).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		password  string
+		encoded   string
+		plaintext bool
+		ok        bool
+		rehash    bool
+	}{
+		{"argon2id", "correct horse", argonHash, false, true, false},
+		{"argon2id mismatch", "wrong", argonHash, false, false, false},
+		{"bcrypt with argon2id configured", "correct horse", bcryptHash, false, true, true},
+		{"bcrypt mismatch", "wrong", bcryptHash, false, false, false},
+		{"plaintext", "correct horse", "correct horse", true, true, true},
+		{"plaintext mismatch", "wrong", "correct horse", true, false, false},
+		{"plaintext starting with $", "$ecret", "$ecret", true, true, true},
+		{"plaintext with argon2id prefix", "$argon2id$x", "$argon2id$x", true, true, true},
+		{"plaintext with bcrypt prefix", "$2a$10$short", "$2a$10$short", true, true, true},
+		{"plaintext with bcrypt prefix mismatch", "wrong", "$2b$10$short", true, false, false},
+	}
+	for _, c := range cases {
+		if got := IsPlaintext(c.encoded); got != c.plaintext {
+			t.Errorf("%s: IsPlaintext=%v, want %v", c.name, got, c.plaintext)
+		}
+		ok, rehash, err := argon.Verify(c.password, c.encoded)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if ok != c.ok || rehash != c.rehash {
+			t.Errorf("%s: ok=%v rehash=%v, want ok=%v rehash=%v", c.name, ok, rehash, c.ok, c.rehash)
+		}
+	}
+}
+
+func TestVerifyOutdatedParams(t *testing.T) {
+	old := newHasher(Argon2id)
+	hash, err := old.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := newHasher(Argon2id)
+	current.conf.Iterations = 2
+	ok, rehash, err := current.Verify("correct horse", hash)
+	if err != nil || !ok || !rehash {
+		t.Errorf("ok=%v rehash=%v err=%v, want ok and rehash", ok, rehash, err)
+	}
+}
@@ -0,0 +1,118 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+)
+
+// 校验规则名称，随错误详情返回给调用方
+const (
+	RuleMinLength = "minLength"
+	RuleMaxLength = "maxLength"
+	RuleClasses   = "characterClasses"
+	RuleEmail     = "equalsEmail"
+	RuleCommon    = "common"
+	RuleHistory   = "history"
+)
+
+const (
+	classLower = 1 << iota
+	classUpper
+	classDigit
+	classOther
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Violation 未通过的密码规则
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Policy 密码强度策略，常见密码列表随程序打包，不依赖外部服务
+type Policy struct {
+	conf   config.PasswordPolicyConf
+	common map[string]struct{}
+}
+
+func NewPolicy(config *config.Config) *Policy {
+	p := &Policy{conf: config.PasswordPolicyConf, common: make(map[string]struct{})}
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswords))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.common[strings.ToLower(line)] = struct{}{}
+	}
+	return p
+}
+
+// HistorySize 需要检查的最近密码数量，包括当前密码
+func (p *Policy) HistorySize() int {
+	return p.conf.HistorySize
+}
+
+// Check 返回全部未通过的规则，全部通过时返回空，长度按字符计算
+func (p *Policy) Check(password, email string) []*Violation {
+	var violations []*Violation
+	length := utf8.RuneCountInString(password)
+	if length < p.conf.MinLength {
+		violations = append(violations, &Violation{Rule: RuleMinLength, Description: "密码长度过短"})
+	}
+	if p.conf.MaxLength > 0 && length > p.conf.MaxLength {
+		violations = append(violations, &Violation{Rule: RuleMaxLength, Description: "密码长度过长"})
+	}
+	if countClasses(password) < p.conf.MinClasses {
+		violations = append(violations, &Violation{Rule: RuleClasses, Description: "密码包含的字符种类过少"})
+	}
+	if p.conf.RejectEmail && equalsEmail(password, email) {
+		violations = append(violations, &Violation{Rule: RuleEmail, Description: "密码不能与邮箱相同"})
+	}
+	if p.conf.RejectCommon {
+		if _, ok := p.common[strings.ToLower(password)]; ok {
+			violations = append(violations, &Violation{Rule: RuleCommon, Description: "密码过于常见"})
+		}
+	}
+	return violations
+}
+
+func countClasses(password string) int {
+	classes := 0
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			classes |= classLower
+		case unicode.IsUpper(r):
+			classes |= classUpper
+		case unicode.IsDigit(r):
+			classes |= classDigit
+		default:
+			classes |= classOther
+		}
+	}
+	n := 0
+	for ; classes > 0; classes &= classes - 1 {
+		n++
+	}
+	return n
+}
+
+// 与完整邮箱或邮箱用户名相同时视为相同，忽略大小写
+func equalsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	if strings.EqualFold(password, email) {
+		return true
+	}
+	local, _, ok := strings.Cut(email, "@")
+	return ok && local != "" && strings.EqualFold(password, local)
+}
@@ -0,0 +1,88 @@
+package ticket
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+var consumeScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	redis.call('DEL', KEYS[1])
+end
+return v
+`)
+
+// Store 签发一次性的不透明凭证，Redis 中只保存凭证的哈希
+type Store struct {
+	redis *redis.Redis
+}
+
+func NewStore(redis *redis.Redis) *Store {
+	return &Store{redis: redis}
+}
+
+// Issue 签发凭证，data 序列化后随凭证保存
+func (s *Store) Issue(ctx context.Context, kind string, data any, ttl int) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	value, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	if err = s.redis.SetexCtx(ctx, key(kind, token), string(value), ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume 消费凭证并取出数据，凭证不存在或已被使用时返回 ErrInvalidTicket
+func (s *Store) Consume(ctx context.Context, kind, token string, data any) error {
+	if token == "" {
+		return consts.ErrInvalidTicket
+	}
+	res, err := s.redis.ScriptRunCtx(ctx, consumeScript, []string{key(kind, token)})
+	switch {
+	case errors.Is(err, redis.Nil):
+		return consts.ErrInvalidTicket
+	case err != nil:
+		return err
+	}
+	value, ok := res.(string)
+	if !ok {
+		return consts.ErrInvalidTicket
+	}
+	return json.Unmarshal([]byte(value), data)
+}
+
+// Peek 取出凭证数据但不消费，用于在执行可能失败的校验前确认凭证有效，之后仍需 Consume
+func (s *Store) Peek(ctx context.Context, kind, token string, data any) error {
+	if token == "" {
+		return consts.ErrInvalidTicket
+	}
+	value, err := s.redis.GetCtx(ctx, key(kind, token))
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return consts.ErrInvalidTicket
+	}
+	return json.Unmarshal([]byte(value), data)
+}
+
+func key(kind, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%s:%s", kind, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,99 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// Device 登录时记录的设备信息
+type Device struct {
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	AuthType   int64
+}
+
+// Session 一次登录产生的会话，id 与令牌族相同
+type Session struct {
+	Id         string
+	UserId     string
+	DeviceName string
+	UserAgent  string
+	Ip         string
+	AuthType   int64
+	CreateAt   int64
+	LastSeen   int64
+}
+
+// Sessions 列出用户仍然有效的会话，按最近活跃时间倒序
+func (m *Manager) Sessions(ctx context.Context, userId string) ([]*Session, error) {
+	familiesKey := fmt.Sprintf("%s:%s", consts.UserFamilies, userId)
+	families, err := m.redis.SmembersCtx(ctx, familiesKey)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(families))
+	for _, family := range families {
+		v, err := m.redis.HgetallCtx(ctx, fmt.Sprintf("%s:%s", consts.TokenFamily, family))
+		if err != nil {
+			return nil, err
+		}
+		if v["userId"] != userId {
+			// 会话已过期或被吊销，顺带清理索引
+			if _, err = m.redis.SremCtx(ctx, familiesKey, family); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		session := &Session{
+			Id:         family,
+			UserId:     userId,
+			DeviceName: v["deviceName"],
+			UserAgent:  v["userAgent"],
+			Ip:         v["ip"],
+		}
+		session.AuthType, _ = strconv.ParseInt(v["authType"], 10, 64)
+		session.CreateAt, _ = strconv.ParseInt(v["createAt"], 10, 64)
+		session.LastSeen, _ = strconv.ParseInt(v["lastSeen"], 10, 64)
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen > sessions[j].LastSeen
+	})
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的指定会话，会话不属于该用户时返回 ErrSessionNotFound
+func (m *Manager) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	owner, err := m.redis.HgetCtx(ctx, fmt.Sprintf("%s:%s", consts.TokenFamily, sessionId), "userId")
+	if errors.Is(err, redis.Nil) || (err == nil && owner != userId) {
+		return consts.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return m.RevokeFamily(ctx, sessionId)
+}
+
+// RevokeOtherSessions 吊销用户除 currentId 以外的全部会话
+func (m *Manager) RevokeOtherSessions(ctx context.Context, userId, currentId string) error {
+	families, err := m.redis.SmembersCtx(ctx, fmt.Sprintf("%s:%s", consts.UserFamilies, userId))
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if family == currentId {
+			continue
+		}
+		if err = m.RevokeFamily(ctx, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
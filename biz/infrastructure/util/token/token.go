@@ -0,0 +1,409 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/jwt"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/keyring"
+	"github.com/samber/lo"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// ARGV: 用户id、令牌族、有效期
+var saveScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], 'userId', ARGV[1], 'family', ARGV[2], 'used', 0)
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 0
+`)
+
+// 会话仍存在时更新最近活跃时间并延长有效期，会话不存在时返回空，ARGV: 最近活跃时间、有效期
+var touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+redis.call('HSET', KEYS[1], 'lastSeen', ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// 标记刷新令牌已使用，返回使用次数、用户id、令牌族，令牌不存在时返回空
+var useScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {}
+end
+local used = redis.call('HINCRBY', KEYS[1], 'used', 1)
+local v = redis.call('HMGET', KEYS[1], 'userId', 'family')
+return {used, v[1], v[2]}
+`)
+
+// TypClientAccess 签发给 OpenID Connect 客户端的访问令牌的 typ，见 RFC 9068，不能用于访问本服务的其他接口
+const TypClientAccess = "at+jwt"
+
+// Claims 访问令牌的载荷
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	IssuedMs  int64    `json:"iat_ms,omitempty"` // 毫秒精度的签发时间，用于与用户吊销时间比较
+	ID        string   `json:"jti"`
+	Role      int64    `json:"role"`
+	Scope     string   `json:"scope,omitempty"`     // 签发给客户端的访问令牌的授权范围
+	Sid       string   `json:"sid,omitempty"`       // 会话id，即令牌族
+	ClientId  string   `json:"client_id,omitempty"` // 签发给客户端的访问令牌所属的客户端
+}
+
+// Pair 一次签发的访问令牌与刷新令牌
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	SessionId    string
+}
+
+// RefreshRecord 刷新令牌对应的用户与令牌族，同一次登录轮换出的刷新令牌属于同一族
+type RefreshRecord struct {
+	UserId string
+	Family string
+}
+
+// Manager 签发 JWT 访问令牌与轮换式的不透明刷新令牌
+type Manager struct {
+	redis   *redis.Redis
+	conf    config.TokenConf
+	keyring *keyring.Keyring
+}
+
+func NewManager(config *config.Config, redis *redis.Redis, keyring *keyring.Keyring) *Manager {
+	return &Manager{
+		redis:   redis,
+		conf:    config.TokenConf,
+		keyring: keyring,
+	}
+}
+
+// Issue 为一次新的登录签发令牌，创建新的令牌族，令牌族即登录会话
+func (m *Manager) Issue(ctx context.Context, userId string, role int64, device *Device) (*Pair, error) {
+	family := randomString(16)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	familyKey := fmt.Sprintf("%s:%s", consts.TokenFamily, family)
+	if err := m.redis.HmsetCtx(ctx, familyKey, map[string]string{
+		"userId":     userId,
+		"deviceName": device.DeviceName,
+		"userAgent":  device.UserAgent,
+		"ip":         device.Ip,
+		"authType":   strconv.FormatInt(device.AuthType, 10),
+		"createAt":   now,
+		"lastSeen":   now,
+	}); err != nil {
+		return nil, err
+	}
+	if err := m.redis.ExpireCtx(ctx, familyKey, m.conf.RefreshTTL); err != nil {
+		return nil, err
+	}
+	familiesKey := fmt.Sprintf("%s:%s", consts.UserFamilies, userId)
+	if _, err := m.redis.SaddCtx(ctx, familiesKey, family); err != nil {
+		return nil, err
+	}
+	if err := m.redis.ExpireCtx(ctx, familiesKey, m.conf.RefreshTTL); err != nil {
+		return nil, err
+	}
+	pair, err := m.sign(ctx, family, userId, role)
+	if err != nil {
+		return nil, err
+	}
+	pair.SessionId = family
+	return pair, nil
+}
+
+// IssueInFamily 在已有令牌族中签发令牌，并更新会话的最近活跃时间与有效期
+func (m *Manager) IssueInFamily(ctx context.Context, family, userId string, role int64) (*Pair, error) {
+	_, err := m.redis.ScriptRunCtx(ctx, touchScript, []string{fmt.Sprintf("%s:%s", consts.TokenFamily, family)},
+		time.Now().Unix(), m.conf.RefreshTTL)
+	if errors.Is(err, redis.Nil) {
+		return nil, consts.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = m.redis.ExpireCtx(ctx, fmt.Sprintf("%s:%s", consts.UserFamilies, userId), m.conf.RefreshTTL); err != nil {
+		return nil, err
+	}
+	pair, err := m.sign(ctx, family, userId, role)
+	if err != nil {
+		return nil, err
+	}
+	pair.SessionId = family
+	return pair, nil
+}
+
+func (m *Manager) sign(ctx context.Context, family, userId string, role int64) (*Pair, error) {
+	key, err := m.keyring.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	access, err := jwt.Sign(&jwt.Header{Alg: key.Algorithm, Kid: key.Kid}, &Claims{
+		Issuer:    m.conf.Issuer,
+		Subject:   userId,
+		Audience:  m.conf.Audience,
+		ExpiresAt: now.Add(time.Duration(m.conf.AccessTTL) * time.Second).Unix(),
+		IssuedAt:  now.Unix(),
+		IssuedMs:  now.UnixMilli(),
+		ID:        randomString(16),
+		Role:      role,
+		Sid:       family,
+	}, key.Signer)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := randomString(32)
+	if _, err = m.redis.ScriptRunCtx(ctx, saveScript, []string{refreshKey(refresh)}, userId, family, m.conf.RefreshTTL); err != nil {
+		return nil, err
+	}
+	return &Pair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(m.conf.AccessTTL),
+	}, nil
+}
+
+// IssueClientAccess 为 OpenID Connect 客户端签发访问令牌，不创建令牌族也不签发刷新令牌，
+// 令牌归属于用户授权时的登录会话 sid，会话注销或用户令牌被吊销时一并失效
+func (m *Manager) IssueClientAccess(userId string, role int64, clientId, sid, scope, audience string) (string, int64, error) {
+	key, err := m.keyring.SigningKey()
+	if err != nil {
+		return "", 0, err
+	}
+	now := time.Now()
+	access, err := jwt.Sign(&jwt.Header{Alg: key.Algorithm, Typ: TypClientAccess, Kid: key.Kid}, &Claims{
+		Issuer:    m.conf.Issuer,
+		Subject:   userId,
+		Audience:  []string{audience},
+		ExpiresAt: now.Add(time.Duration(m.conf.AccessTTL) * time.Second).Unix(),
+		IssuedAt:  now.Unix(),
+		IssuedMs:  now.UnixMilli(),
+		ID:        randomString(16),
+		Role:      role,
+		Scope:     scope,
+		Sid:       sid,
+		ClientId:  clientId,
+	}, key.Signer)
+	if err != nil {
+		return "", 0, err
+	}
+	return access, int64(m.conf.AccessTTL), nil
+}
+
+// Rotate 使用刷新令牌，每个刷新令牌只能使用一次，重复使用视为泄露并吊销整个令牌族
+func (m *Manager) Rotate(ctx context.Context, refreshToken string) (*RefreshRecord, error) {
+	record, used, err := m.use(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if used > 1 {
+		if err = m.RevokeFamily(ctx, record.Family); err != nil {
+			return nil, err
+		}
+		return nil, consts.ErrTokenReused
+	}
+	ok, err := m.redis.ExistsCtx(ctx, fmt.Sprintf("%s:%s", consts.TokenFamily, record.Family))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, consts.ErrInvalidToken
+	}
+	return record, nil
+}
+
+// Lookup 查询刷新令牌所属的令牌族，不消耗令牌
+func (m *Manager) Lookup(ctx context.Context, refreshToken string) (*RefreshRecord, error) {
+	if refreshToken == "" {
+		return nil, consts.ErrInvalidToken
+	}
+	v, err := m.redis.HmgetCtx(ctx, refreshKey(refreshToken), "userId", "family")
+	if err != nil {
+		return nil, err
+	}
+	if len(v) != 2 || v[0] == "" || v[1] == "" {
+		return nil, consts.ErrInvalidToken
+	}
+	return &RefreshRecord{UserId: v[0], Family: v[1]}, nil
+}
+
+// RevokeFamily 吊销令牌族，族内所有刷新令牌失效
+func (m *Manager) RevokeFamily(ctx context.Context, family string) error {
+	familyKey := fmt.Sprintf("%s:%s", consts.TokenFamily, family)
+	userId, err := m.redis.HgetCtx(ctx, familyKey, "userId")
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = m.redis.DelCtx(ctx, familyKey); err != nil {
+		return err
+	}
+	if userId != "" {
+		_, err = m.redis.SremCtx(ctx, fmt.Sprintf("%s:%s", consts.UserFamilies, userId), family)
+	}
+	return err
+}
+
+// Revoke 将访问令牌加入吊销列表，直到其自然过期
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	ttl := claims.ExpiresAt - time.Now().Unix()
+	if ttl <= 0 {
+		return nil
+	}
+	return m.redis.SetexCtx(ctx, fmt.Sprintf("%s:%s", consts.RevokedToken, claims.ID), "1", int(ttl))
+}
+
+// RevokeUser 吊销用户的全部令牌族，并使此前签发的访问令牌失效，吊销时间精确到毫秒
+func (m *Manager) RevokeUser(ctx context.Context, userId string) error {
+	if err := m.redis.SetexCtx(ctx, fmt.Sprintf("%s:%s", consts.UserRevokedAt, userId),
+		strconv.FormatInt(time.Now().UnixMilli(), 10), m.conf.AccessTTL); err != nil {
+		return err
+	}
+	familiesKey := fmt.Sprintf("%s:%s", consts.UserFamilies, userId)
+	families, err := m.redis.SmembersCtx(ctx, familiesKey)
+	if err != nil {
+		return err
+	}
+	keys := lo.Map(families, func(family string, _ int) string {
+		return fmt.Sprintf("%s:%s", consts.TokenFamily, family)
+	})
+	_, err = m.redis.DelCtx(ctx, append(keys, familiesKey)...)
+	return err
+}
+
+// Introspect 校验访问令牌并检查吊销列表，令牌无效时 active 为 false
+func (m *Manager) Introspect(ctx context.Context, accessToken string) (claims *Claims, active bool, err error) {
+	claims, err = m.Verify(accessToken)
+	if err != nil {
+		return nil, false, nil
+	}
+	return m.checkRevoked(ctx, claims)
+}
+
+// IntrospectClientAccess 校验签发给客户端且受众为 audience 的访问令牌，令牌无效时 active 为 false
+func (m *Manager) IntrospectClientAccess(ctx context.Context, accessToken, audience string) (claims *Claims, active bool, err error) {
+	claims, err = m.verify(accessToken, true, []string{audience})
+	if err != nil {
+		return nil, false, nil
+	}
+	return m.checkRevoked(ctx, claims)
+}
+
+func (m *Manager) checkRevoked(ctx context.Context, claims *Claims) (*Claims, bool, error) {
+	revoked, err := m.redis.ExistsCtx(ctx, fmt.Sprintf("%s:%s", consts.RevokedToken, claims.ID))
+	if err != nil || revoked {
+		return nil, false, err
+	}
+	if claims.Sid != "" {
+		alive, err := m.redis.ExistsCtx(ctx, fmt.Sprintf("%s:%s", consts.TokenFamily, claims.Sid))
+		if err != nil || !alive {
+			return nil, false, err
+		}
+	}
+	revokedAt, err := m.redis.GetCtx(ctx, fmt.Sprintf("%s:%s", consts.UserRevokedAt, claims.Subject))
+	if err != nil {
+		return nil, false, err
+	}
+	if revokedAt != "" {
+		if at, _ := strconv.ParseInt(revokedAt, 10, 64); issuedMs(claims) <= revokedMs(at) {
+			return nil, false, nil
+		}
+	}
+	return claims, true, nil
+}
+
+// 没有毫秒签发时间的旧令牌按所在秒的开始比较，同一秒内签发的视为已吊销
+func issuedMs(claims *Claims) int64 {
+	if claims.IssuedMs != 0 {
+		return claims.IssuedMs
+	}
+	return claims.IssuedAt * 1000
+}
+
+// 旧版本按秒记录吊销时间，按所在秒的结束比较
+func revokedMs(at int64) int64 {
+	if at < 1e12 {
+		return at*1000 + 999
+	}
+	return at
+}
+
+// Verify 校验访问令牌的签名、签发者、受众与有效期，签发给客户端的访问令牌视为无效
+func (m *Manager) Verify(accessToken string) (*Claims, error) {
+	return m.verify(accessToken, false, m.conf.Audience)
+}
+
+func (m *Manager) verify(accessToken string, client bool, audience []string) (*Claims, error) {
+	claims := new(Claims)
+	header, err := jwt.Parse(accessToken, claims, func(header *jwt.Header) (any, error) {
+		key, ok := m.keyring.VerificationKey(header.Kid)
+		if !ok || header.Alg != key.Algorithm {
+			return nil, jwt.ErrInvalidKey
+		}
+		return key.Public, nil
+	})
+	if err != nil || (header.Typ == TypClientAccess) != client || (claims.ClientId != "") != client {
+		return nil, consts.ErrInvalidToken
+	}
+	if claims.Issuer != m.conf.Issuer || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, consts.ErrInvalidToken
+	}
+	if len(audience) > 0 && len(lo.Intersect(claims.Audience, audience)) == 0 {
+		return nil, consts.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (m *Manager) use(ctx context.Context, refreshToken string) (*RefreshRecord, int64, error) {
+	if refreshToken == "" {
+		return nil, 0, consts.ErrInvalidToken
+	}
+	res, err := m.redis.ScriptRunCtx(ctx, useScript, []string{refreshKey(refreshToken)})
+	if err != nil {
+		return nil, 0, err
+	}
+	v, ok := res.([]any)
+	if !ok || len(v) != 3 {
+		return nil, 0, consts.ErrInvalidToken
+	}
+	used, _ := v[0].(int64)
+	userId, _ := v[1].(string)
+	family, _ := v[2].(string)
+	if userId == "" || family == "" {
+		return nil, 0, consts.ErrInvalidToken
+	}
+	return &RefreshRecord{UserId: userId, Family: family}, used, nil
+}
+
+func refreshKey(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return fmt.Sprintf("%s:%s", consts.RefreshToken, hex.EncodeToString(sum[:]))
+}
+
+// crypto/rand 读取失败意味着系统随机源不可用，无法继续安全地签发令牌
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
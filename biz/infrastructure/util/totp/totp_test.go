@@ -0,0 +1,146 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+)
+
+// RFC 6238 附录 B 中 SHA1 的测试密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func newTOTP(digits int, now time.Time) *TOTP {
+	return NewTOTP(&config.Config{TOTPConf: config.TOTPConf{
+		Issuer: "CloudMind",
+		Digits: digits,
+		Period: 30,
+		Skew:   1,
+	}}).WithClock(func() time.Time { return now })
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		code, err := newTOTP(8, time.Unix(c.unix, 0)).Code(rfcSecret)
+		if err != nil {
+			t.Fatalf("unix=%d: %v", c.unix, err)
+		}
+		if code != c.code {
+			t.Errorf("unix=%d: got %s, want %s", c.unix, code, c.code)
+		}
+	}
+}
+
+func TestCodeSixDigits(t *testing.T) {
+	// 6 位密码为 8 位密码的末 6 位
+	code, err := newTOTP(6, time.Unix(59, 0)).Code(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Errorf("got %s, want 287082", code)
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := now.Unix() / 30
+	cases := []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{-60 * time.Second, false},
+		{-30 * time.Second, true},
+		{0, true},
+		{30 * time.Second, true},
+		{60 * time.Second, false},
+	}
+	for _, c := range cases {
+		code, err := newTOTP(6, now.Add(c.offset)).Code(rfcSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := newTOTP(6, now).Validate(rfcSecret, code)
+		if ok != c.ok {
+			t.Errorf("offset=%s: ok=%v, want %v", c.offset, ok, c.ok)
+			continue
+		}
+		if ok && step != counter+int64(c.offset/(30*time.Second)) {
+			t.Errorf("offset=%s: step=%d, want %d", c.offset, step, counter+int64(c.offset/(30*time.Second)))
+		}
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	totp := newTOTP(6, time.Unix(59, 0))
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := totp.Validate(rfcSecret, code); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := totp.Validate("not base32!", "287082"); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+// 同一密码在有效期内的任意时刻校验都返回相同的时间步，调用方按时间步记录已使用的密码即可防止重放，
+// 记录的保留时长 StepTTL 需覆盖密码保持有效的全部时间
+func TestValidateReplayStep(t *testing.T) {
+	issued := time.Unix(1111111110, 0)
+	code, err := newTOTP(6, issued).Code(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := issued.Unix() / 30
+	var first, last time.Time
+	for d := -5 * 30 * time.Second; d <= 5*30*time.Second; d += time.Second {
+		at := issued.Add(d)
+		step, ok := newTOTP(6, at).Validate(rfcSecret, code)
+		if !ok {
+			continue
+		}
+		if step != want {
+			t.Fatalf("at %+ds: step=%d, want %d", int(d.Seconds()), step, want)
+		}
+		if first.IsZero() {
+			first = at
+		}
+		last = at
+	}
+	valid := last.Sub(first) + time.Second
+	if ttl := time.Duration(newTOTP(6, issued).StepTTL()) * time.Second; valid > ttl {
+		t.Errorf("code valid for %s, longer than StepTTL %s", valid, ttl)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	totp := NewTOTP(&config.Config{TOTPConf: config.TOTPConf{RecoveryCodes: 10}})
+	codes, hashes, err := totp.RecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes, %d hashes", len(codes), len(hashes))
+	}
+	for i, code := range codes {
+		if HashRecoveryCode(code) != hashes[i] {
+			t.Errorf("hash mismatch for %s", code)
+		}
+		// 用户输入时忽略大小写、分隔符与首尾空格
+		if HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))+" ") != hashes[i] {
+			t.Errorf("normalized hash mismatch for %s", code)
+		}
+	}
+}
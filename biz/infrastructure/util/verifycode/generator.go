@@ -0,0 +1,50 @@
+package verifycode
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+)
+
+const (
+	Numeric      = "numeric"
+	Alphanumeric = "alphanumeric"
+)
+
+var alphabets = map[string]string{
+	Numeric:      "0123456789",
+	Alphanumeric: "23456789ABCDEFGHJKMNPQRSTUVWXYZ",
+}
+
+// Generator 使用 crypto/rand 按用途对应的策略生成验证码
+type Generator struct {
+	conf config.VerifyCodeConf
+}
+
+func NewGenerator(config *config.Config) *Generator {
+	return &Generator{conf: config.VerifyCodeConf}
+}
+
+// Generate 生成验证码，未单独配置策略的用途使用默认策略
+func (g *Generator) Generate(purpose string) (string, error) {
+	policy, ok := g.conf.Policies[purpose]
+	if !ok {
+		policy = g.conf.Policy
+	}
+	alphabet, ok := alphabets[policy.Alphabet]
+	if !ok {
+		alphabet = alphabets[Numeric]
+	}
+
+	max := big.NewInt(int64(len(alphabet)))
+	code := make([]byte, policy.Length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
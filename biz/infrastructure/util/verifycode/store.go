@@ -0,0 +1,82 @@
+package verifycode
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/consts"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	verifyOk = iota
+	verifyNotFound
+	verifyNotEqual
+)
+
+// ARGV: 验证码、有效期
+var saveScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'code', ARGV[1], 'attempts', 0)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 0
+`)
+
+// ARGV: 待校验的验证码、允许的错误次数
+// 校验通过或错误次数达到上限时删除验证码
+var verifyScript = redis.NewScript(`
+local code = redis.call('HGET', KEYS[1], 'code')
+if not code then
+	return 1
+end
+if code == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+local n = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if n >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+end
+return 2
+`)
+
+// Store 保存验证码并记录错误次数，验证码只能成功使用一次
+type Store struct {
+	redis *redis.Redis
+	conf  config.VerifyCodeConf
+}
+
+func NewStore(config *config.Config, redis *redis.Redis) *Store {
+	return &Store{
+		redis: redis,
+		conf:  config.VerifyCodeConf,
+	}
+}
+
+// Save 保存验证码，覆盖同一键下尚未使用的旧验证码
+func (s *Store) Save(ctx context.Context, key, code string) error {
+	_, err := s.redis.ScriptRunCtx(ctx, saveScript, []string{key}, code, s.conf.TTL)
+	return err
+}
+
+// Verify 校验并消费验证码，不存在或已作废返回 ErrCodeNotFound，不匹配返回 ErrCodeNotEqual
+func (s *Store) Verify(ctx context.Context, key, code string) error {
+	if code == "" {
+		return consts.ErrCodeNotEqual
+	}
+	res, err := s.redis.ScriptRunCtx(ctx, verifyScript, []string{key}, code, s.conf.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	switch res.(int64) {
+	case verifyOk:
+		return nil
+	case verifyNotFound:
+		return consts.ErrCodeNotFound
+	case verifyNotEqual:
+		return consts.ErrCodeNotEqual
+	default:
+		return fmt.Errorf("verifycode: unexpected script result %v", res)
+	}
+}
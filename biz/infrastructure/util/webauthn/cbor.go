@@ -0,0 +1,149 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// 只实现 WebAuthn 需要的 CBOR 子集：整数、字节串、文本串、数组、映射、标签与 true/false/null，不支持不定长编码与浮点数
+const maxCBORDepth = 16
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR 解码一个 CBOR 数据项，返回解码结果与剩余的字节
+// 整数解码为 int64，字节串为 []byte，文本串为 string，数组为 []any，映射为 map[any]any
+func decodeCBOR(data []byte) (any, []byte, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, data[d.pos:], nil
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxCBORDepth || d.pos >= len(d.data) {
+		return nil, ErrMalformed
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		default:
+			return nil, ErrMalformed
+		}
+	}
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, ErrMalformed
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, ErrMalformed
+		}
+		return -1 - int64(n), nil
+	case 2:
+		return d.bytes(n)
+	case 3:
+		b, err := d.bytes(n)
+		return string(b), err
+	case 4:
+		// 每个元素至少占一个字节，据此拒绝声明长度过大的数组
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrMalformed
+		}
+		arr := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		if n > uint64(len(d.data)-d.pos)/2 {
+			return nil, ErrMalformed
+		}
+		m := make(map[any]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, ErrMalformed
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 6:
+		return d.value(depth + 1)
+	default:
+		return nil, ErrMalformed
+	}
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.bytes(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.bytes(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.bytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.bytes(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	default:
+		return 0, ErrMalformed
+	}
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrMalformed
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
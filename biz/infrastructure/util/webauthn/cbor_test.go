@@ -0,0 +1,118 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// 取自 RFC 8949 附录 A 中本解码器支持的部分
+func TestDecodeCBOR(t *testing.T) {
+	cases := []struct {
+		in   string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"1b7fffffffffffffff", int64(9223372036854775807)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"390100", int64(-257)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"40", []byte{}},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"80", []any{}},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"a0", map[any]any{}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"c11a514b67b0", int64(1363896240)},
+	}
+	for _, c := range cases {
+		got, rest, err := decodeCBOR(mustHex(t, c.in))
+		if err != nil {
+			t.Errorf("%s: %v", c.in, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d trailing bytes", c.in, len(rest))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestDecodeCBORRest(t *testing.T) {
+	got, rest, err := decodeCBOR(mustHex(t, "0102ff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != int64(1) || hex.EncodeToString(rest) != "02ff" {
+		t.Errorf("got %v, rest %x", got, rest)
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"truncated argument", "19e8"},
+		{"reserved additional info", "1c"},
+		{"indefinite length", "5f"},
+		{"uint64 overflow", "1b8000000000000000"},
+		{"negative overflow", "3b8000000000000000"},
+		{"truncated bytes", "4401"},
+		{"truncated text", "6449"},
+		{"array length beyond input", "9a7fffffff"},
+		{"map length beyond input", "ba7fffffff00"},
+		{"truncated array", "830102"},
+		{"truncated map", "a20102"},
+		{"byte string key", "a1410101"},
+		{"array key", "a1800101"},
+		{"float", "f93c00"},
+		{"undefined", "f7"},
+		{"simple value", "e0"},
+		{"byte length overflow", "5bffffffffffffffff"},
+		{"nesting too deep", "818181818181818181818181818181818100"},
+	}
+	for _, c := range cases {
+		if _, _, err := decodeCBOR(mustHex(t, c.in)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want ErrMalformed", c.name, err)
+		}
+	}
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, seed := range []string{"00", "a26161016162820203", "8301820203820405", "c11a514b67b0", "9a7fffffff", "5f"} {
+		b, _ := hex.DecodeString(seed)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := decodeCBOR(data)
+		if err == nil && len(rest) > len(data) {
+			t.Fatalf("rest longer than input")
+		}
+	})
+}
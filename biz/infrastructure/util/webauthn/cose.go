@@ -0,0 +1,87 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// COSE 算法标识，见 RFC 8152 与 IANA COSE Algorithms
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+const (
+	coseKty    = 1
+	coseAlg    = 3
+	coseCrv    = -1
+	coseX      = -2
+	coseY      = -3
+	coseRSAN   = -1
+	coseRSAE   = -2
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	minRSABits = 2048
+)
+
+// parseCOSEKey 解析 COSE_Key 格式的公钥，返回公钥、算法与剩余的字节
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, []byte, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, 0, nil, ErrMalformed
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, nil, ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, nil, ErrUnsupportedKey
+		}
+		return pub, alg, rest, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseRSAN)].([]byte)
+		e, _ := m[int64(coseRSAE)].([]byte)
+		if len(n)*8 < minRSABits || len(e) == 0 || len(e) > 4 {
+			return nil, 0, nil, ErrUnsupportedKey
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return pub, alg, rest, nil
+	default:
+		return nil, 0, nil, ErrUnsupportedKey
+	}
+}
+
+// verifySignature 校验断言签名，ES256 签名为 ASN.1 DER 编码
+func verifySignature(pub crypto.PublicKey, alg int64, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 || !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg != AlgRS256 || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrUnsupportedKey
+	}
+}
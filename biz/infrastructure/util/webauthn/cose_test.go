@@ -0,0 +1,149 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// 按 COSE_Key 格式手工编码公钥，键按 CTAP2 规范顺序排列
+func ec2Key(x, y []byte, crv byte) []byte {
+	b := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, crv}
+	b = append(append(b, 0x21, 0x58, byte(len(x))), x...)
+	return append(append(b, 0x22, 0x58, byte(len(y))), y...)
+}
+
+func rsaKey(n, e []byte) []byte {
+	b := []byte{0xa4, 0x01, 0x03, 0x03, 0x39, 0x01, 0x00}
+	b = append(append(b, 0x20, 0x59, byte(len(n)>>8), byte(len(n))), n...)
+	return append(append(b, 0x21, 0x40|byte(len(e))), e...)
+}
+
+func ecPoint(t testing.TB, priv *ecdsa.PrivateKey) ([]byte, []byte) {
+	t.Helper()
+	x, y := make([]byte, 32), make([]byte, 32)
+	priv.X.FillBytes(x)
+	priv.Y.FillBytes(y)
+	return x, y
+}
+
+func TestParseCOSEKeyES256(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := ecPoint(t, priv)
+	pub, alg, rest, err := parseCOSEKey(append(ec2Key(x, y, 1), 0xa0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg != AlgES256 || len(rest) != 1 {
+		t.Fatalf("alg=%d, rest=%x", alg, rest)
+	}
+	if !priv.PublicKey.Equal(pub) {
+		t.Fatal("public key mismatch")
+	}
+
+	data := []byte("authenticatorData||clientDataHash")
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifySignature(pub, alg, data, sig); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err = verifySignature(pub, alg, append(data, 0), sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered data: got %v", err)
+	}
+	if err = verifySignature(pub, AlgRS256, data, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("mismatched alg: got %v", err)
+	}
+}
+
+func TestParseCOSEKeyRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, alg, _, err := parseCOSEKey(rsaKey(priv.N.Bytes(), []byte{1, 0, 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg != AlgRS256 || !priv.PublicKey.Equal(pub) {
+		t.Fatalf("alg=%d, key mismatch", alg)
+	}
+	data := []byte("authenticatorData||clientDataHash")
+	digest := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifySignature(pub, alg, data, sig); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err = verifySignature(pub, alg, data, sig[1:]); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("truncated signature: got %v", err)
+	}
+}
+
+func TestParseCOSEKeyRejects(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := ecPoint(t, priv)
+	offCurve := append([]byte{}, y...)
+	offCurve[31] ^= 1
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"not a map", []byte{0x80}, ErrMalformed},
+		{"truncated", ec2Key(x, y, 1)[:40], ErrMalformed},
+		{"empty map", []byte{0xa0}, ErrUnsupportedKey},
+		{"unsupported curve", ec2Key(x, y, 2), ErrUnsupportedKey},
+		{"short coordinate", ec2Key(x[1:], y, 1), ErrUnsupportedKey},
+		{"point not on curve", ec2Key(x, offCurve, 1), ErrUnsupportedKey},
+		{"rsa key too small", rsaKey(small.N.Bytes(), []byte{1, 0, 1}), ErrUnsupportedKey},
+		{"rsa exponent missing", rsaKey(make([]byte, 256), nil), ErrUnsupportedKey},
+		{"rsa exponent too long", rsaKey(make([]byte, 256), []byte{1, 0, 0, 0, 1}), ErrUnsupportedKey},
+		// kty 为 EC2 但算法为 RS256
+		{"kty and alg mismatch", []byte{0xa2, 0x01, 0x02, 0x03, 0x39, 0x01, 0x00}, ErrUnsupportedKey},
+	}
+	for _, c := range cases {
+		if _, _, _, err := parseCOSEKey(c.in); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func FuzzParseCOSEKey(f *testing.F) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		f.Fatal(err)
+	}
+	x, y := ecPoint(f, priv)
+	f.Add(ec2Key(x, y, 1))
+	f.Add(rsaKey(make([]byte, 256), []byte{1, 0, 1}))
+	f.Add([]byte{0xa0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pub, _, _, err := parseCOSEKey(data)
+		if err != nil {
+			return
+		}
+		// 解析成功的公钥可以直接用于验签，不能因为畸形参数而崩溃
+		_ = verifySignature(pub, AlgES256, data, data)
+		_ = verifySignature(pub, AlgRS256, data, data)
+	})
+}
@@ -0,0 +1,244 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/samber/lo"
+)
+
+var (
+	ErrMalformed              = errors.New("webauthn: malformed data")
+	ErrUnsupportedKey         = errors.New("webauthn: unsupported credential public key")
+	ErrUnsupportedAttestation = errors.New("webauthn: unsupported attestation format")
+	ErrInvalidSignature       = errors.New("webauthn: invalid signature")
+	ErrClientData             = errors.New("webauthn: client data mismatch")
+	ErrRPIDMismatch           = errors.New("webauthn: rp id hash mismatch")
+	ErrUserNotPresent         = errors.New("webauthn: user not present")
+	ErrUserNotVerified        = errors.New("webauthn: user not verified")
+	ErrCloned                 = errors.New("webauthn: sign count did not increase, credential may be cloned")
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// UserEntity 注册时告知认证器的用户信息，Id 会在可发现凭证登录时作为 userHandle 返回
+type UserEntity struct {
+	Id          string
+	Name        string
+	DisplayName string
+}
+
+// Credential 注册成功后需要保存的凭证信息
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key 编码的公钥
+	Algorithm int64
+	SignCount uint32
+}
+
+// WebAuthn 处理通行密钥的注册与断言仪式，只接受 none 格式的证明，支持 ES256 与 RS256
+type WebAuthn struct {
+	conf config.WebAuthnConf
+}
+
+func NewWebAuthn(config *config.Config) *WebAuthn {
+	return &WebAuthn{conf: config.WebAuthnConf}
+}
+
+// Enabled 未配置 RPID 时不启用通行密钥
+func (w *WebAuthn) Enabled() bool {
+	return w.conf.RPID != ""
+}
+
+func (w *WebAuthn) RPID() string {
+	return w.conf.RPID
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// CreationOptions 生成 PublicKeyCredentialCreationOptions 的 JSON 表示，要求创建可发现凭证
+func (w *WebAuthn) CreationOptions(challenge string, user *UserEntity, exclude []string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": w.conf.RPID, "name": w.conf.RPName},
+		"user": map[string]string{
+			"id":          base64.RawURLEncoding.EncodeToString([]byte(user.Id)),
+			"name":        user.Name,
+			"displayName": user.DisplayName,
+		},
+		"pubKeyCredParams": []map[string]any{
+			{"type": "public-key", "alg": AlgES256},
+			{"type": "public-key", "alg": AlgRS256},
+		},
+		"timeout":            w.conf.Timeout * 1000,
+		"attestation":        "none",
+		"excludeCredentials": descriptors(exclude),
+		"authenticatorSelection": map[string]any{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   w.conf.UserVerification,
+		},
+	})
+}
+
+// RequestOptions 生成 PublicKeyCredentialRequestOptions 的 JSON 表示，allow 为空时使用可发现凭证
+func (w *WebAuthn) RequestOptions(challenge string, allow []string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"challenge":        challenge,
+		"rpId":             w.conf.RPID,
+		"timeout":          w.conf.Timeout * 1000,
+		"userVerification": w.conf.UserVerification,
+		"allowCredentials": descriptors(allow),
+	})
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Challenge 取出 clientDataJSON 中的挑战，调用方据此找到对应的仪式
+func (w *WebAuthn) Challenge(clientDataJSON []byte) (string, error) {
+	c := new(clientData)
+	if err := json.Unmarshal(clientDataJSON, c); err != nil || c.Challenge == "" {
+		return "", ErrMalformed
+	}
+	return c.Challenge, nil
+}
+
+// FinishRegistration 校验注册仪式的响应并返回新凭证
+func (w *WebAuthn) FinishRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := w.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	v, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	if format, _ := att["fmt"].(string); format != "none" {
+		return nil, ErrUnsupportedAttestation
+	}
+	raw, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	authData, err := w.parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return nil, ErrMalformed
+	}
+	return authData.credential, nil
+}
+
+// FinishLogin 使用已保存的公钥校验断言，返回新的签名计数
+func (w *WebAuthn) FinishLogin(challenge string, publicKey []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := w.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := w.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	pub, alg, _, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err = verifySignature(pub, alg, append(append([]byte{}, authenticatorData...), clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+	// 计数均为 0 表示认证器不支持计数，否则必须递增
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrCloned
+	}
+	return authData.signCount, nil
+}
+
+func (w *WebAuthn) verifyClientData(raw []byte, typ, challenge string) error {
+	c := new(clientData)
+	if err := json.Unmarshal(raw, c); err != nil {
+		return ErrMalformed
+	}
+	if c.Type != typ || subtle.ConstantTimeCompare([]byte(c.Challenge), []byte(challenge)) != 1 || !lo.Contains(w.conf.Origins, c.Origin) {
+		return ErrClientData
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags      byte
+	signCount  uint32
+	credential *Credential
+}
+
+// 认证器数据布局：rpIdHash(32) flags(1) signCount(4) [aaguid(16) credIdLen(2) credId credPublicKey]
+func (w *WebAuthn) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrMalformed
+	}
+	rpIDHash := sha256.Sum256([]byte(w.conf.RPID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, ErrRPIDMismatch
+	}
+	a := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if a.flags&flagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+	if w.conf.UserVerification == "required" && a.flags&flagUserVerified == 0 {
+		return nil, ErrUserNotVerified
+	}
+	if a.flags&flagAttested == 0 {
+		return a, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrMalformed
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, ErrMalformed
+	}
+	id, rest := rest[:idLen], rest[idLen:]
+	_, alg, after, err := parseCOSEKey(rest)
+	if err != nil {
+		return nil, err
+	}
+	a.credential = &Credential{
+		ID:        append([]byte{}, id...),
+		PublicKey: append([]byte{}, rest[:len(rest)-len(after)]...),
+		Algorithm: alg,
+		SignCount: a.signCount,
+	}
+	return a, nil
+}
+
+func descriptors(ids []string) []*credentialDescriptor {
+	return lo.Map(ids, func(id string, _ int) *credentialDescriptor {
+		return &credentialDescriptor{Type: "public-key", Id: id}
+	})
+}
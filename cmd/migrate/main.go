@@ -0,0 +1,47 @@
+// migrate 部署新版本前执行的离线迁移：检查被多个用户共用的授权信息并建立授权信息唯一索引
+// 存在重复数据时输出报告并以非零状态退出，人工处理后重新执行
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
+)
+
+func main() {
+	if err := run(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context) error {
+	c, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+	m := user.NewMongoMapper(c)
+	duplicates, err := m.FindDuplicateAuths(ctx)
+	if err != nil {
+		return fmt.Errorf("查找重复授权信息失败: %w", err)
+	}
+	for _, d := range duplicates {
+		ids := make([]string, 0, len(d.UserIds))
+		for _, id := range d.UserIds {
+			ids = append(ids, id.Hex())
+		}
+		fmt.Printf("type=%d appId=%s unionId=%s platformId=%s userIds=%v\n",
+			d.Auth.Type, d.Auth.AppId, d.Auth.UnionId, d.Auth.PlatformId, ids)
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%d条授权信息被多个用户共用，需人工处理后才能建立唯一索引", len(duplicates))
+	}
+	if err = m.EnsureAuthIndex(ctx); err != nil {
+		return err
+	}
+	fmt.Println("已建立授权信息唯一索引")
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"github.com/CloudStriver/cloudmind-sts/provider"
 	"github.com/CloudStriver/go-pkg/utils/kitex/middleware"
 	"github.com/CloudStriver/go-pkg/utils/util/log"
@@ -10,6 +11,8 @@ import (
 	"github.com/cloudwego/kitex/server"
 	"github.com/kitex-contrib/obs-opentelemetry/tracing"
 	"net"
+	"net/http"
+	"time"
 )
 
 func main() {
@@ -31,6 +34,25 @@ func main() {
 		server.WithMiddleware(middleware.LogMiddleware(s.Name)),
 	)
 
+	// OpenID Connect 提供方与 Kitex 服务共用进程，未配置监听地址时不启动
+	if s.OIDCConf.ListenOn != "" {
+		// 超时避免慢速客户端长期占用连接
+		httpSvr := &http.Server{
+			Addr:              s.OIDCConf.ListenOn,
+			Handler:           s.OIDCHandler(),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 16,
+		}
+		go func() {
+			if err := httpSvr.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error(err.Error())
+			}
+		}()
+	}
+
 	err = svr.Run()
 	if err != nil {
 		log.Error(err.Error())
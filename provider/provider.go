@@ -3,10 +3,24 @@ package provider
 import (
 	"github.com/CloudStriver/cloudmind-sts/biz/application/service"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/audit"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/client"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/key"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/stores/redis"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/cipher"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/filter"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/keyring"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/limiter"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/lockout"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/oauth"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/password"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/sdk/cos"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/ticket"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/totp"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/verifycode"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/webauthn"
 	"github.com/google/wire"
 )
 
@@ -19,6 +33,10 @@ var ApplicationSet = wire.NewSet(
 	service.AuthSet,
 	service.CosSet,
 	service.FilterSet,
+	service.TokenSet,
+	service.SessionSet,
+	service.AccountSet,
+	service.OIDCSet,
 )
 
 var InfrastructureSet = wire.NewSet(
@@ -26,9 +44,25 @@ var InfrastructureSet = wire.NewSet(
 	redis.NewRedis,
 	cos.NewCosSDK,
 	filter.NewFilter,
+	password.NewHasher,
+	password.NewPolicy,
+	lockout.NewLockout,
+	limiter.NewEmailLimiter,
+	verifycode.NewStore,
+	verifycode.NewGenerator,
+	ticket.NewStore,
+	token.NewManager,
+	cipher.NewCipher,
+	keyring.NewKeyring,
+	totp.NewTOTP,
+	webauthn.NewWebAuthn,
+	oauth.NewRegistry,
 	MapperSet,
 )
 
 var MapperSet = wire.NewSet(
 	user.NewMongoMapper,
+	key.NewMongoMapper,
+	audit.NewMongoMapper,
+	client.NewMongoMapper,
 )
@@ -10,10 +10,24 @@ import (
 	"github.com/CloudStriver/cloudmind-sts/biz/adaptor"
 	"github.com/CloudStriver/cloudmind-sts/biz/application/service"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/config"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/audit"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/client"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/key"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/mapper/user"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/stores/redis"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/cipher"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/filter"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/keyring"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/limiter"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/lockout"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/oauth"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/password"
 	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/sdk/cos"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/ticket"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/token"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/totp"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/verifycode"
+	"github.com/CloudStriver/cloudmind-sts/biz/infrastructure/util/webauthn"
 )
 
 // Injectors from wire.go:
@@ -24,11 +38,46 @@ func NewStsServerImpl() (*adaptor.StsServerImpl, error) {
 		return nil, err
 	}
 	redisRedis := redis.NewRedis(configConfig)
+	hasher := password.NewHasher(configConfig)
 	iUserMongoMapper := user.NewMongoMapper(configConfig)
+	policy := password.NewPolicy(configConfig)
+	lockoutLockout := lockout.NewLockout(configConfig, redisRedis)
+	emailLimiter := limiter.NewEmailLimiter(configConfig, redisRedis)
+	store := verifycode.NewStore(configConfig, redisRedis)
+	generator := verifycode.NewGenerator(configConfig)
+	ticketStore := ticket.NewStore(redisRedis)
+	iKeyMongoMapper := key.NewMongoMapper(configConfig)
+	cipherCipher, err := cipher.NewCipher(configConfig)
+	if err != nil {
+		return nil, err
+	}
+	keyringKeyring, err := keyring.NewKeyring(configConfig, redisRedis, iKeyMongoMapper, cipherCipher)
+	if err != nil {
+		return nil, err
+	}
+	manager := token.NewManager(configConfig, redisRedis, keyringKeyring)
+	totpTOTP := totp.NewTOTP(configConfig)
+	webAuthn := webauthn.NewWebAuthn(configConfig)
+	registry, err := oauth.NewRegistry(configConfig)
+	if err != nil {
+		return nil, err
+	}
 	authServiceImpl := &service.AuthServiceImpl{
 		Config:          configConfig,
 		Redis:           redisRedis,
 		UserMongoMapper: iUserMongoMapper,
+		PasswordHasher:  hasher,
+		PasswordPolicy:  policy,
+		Lockout:         lockoutLockout,
+		EmailLimiter:    emailLimiter,
+		CodeStore:       store,
+		CodeGenerator:   generator,
+		TicketStore:     ticketStore,
+		TokenManager:    manager,
+		Cipher:          cipherCipher,
+		TOTP:            totpTOTP,
+		WebAuthn:        webAuthn,
+		OAuth:           registry,
 	}
 	cosSDK, err := cos.NewCosSDK(configConfig)
 	if err != nil {
@@ -43,11 +92,43 @@ func NewStsServerImpl() (*adaptor.StsServerImpl, error) {
 		Config: configConfig,
 		Filter: illegalWordsSearch,
 	}
+	tokenService := service.TokenService{
+		Config:          configConfig,
+		UserMongoMapper: iUserMongoMapper,
+		TokenManager:    manager,
+		Keyring:         keyringKeyring,
+	}
+	sessionService := service.SessionService{
+		Config:       configConfig,
+		TokenManager: manager,
+	}
+	iAuditMongoMapper := audit.NewMongoMapper(configConfig)
+	accountService := service.AccountService{
+		Config:           configConfig,
+		Redis:            redisRedis,
+		UserMongoMapper:  iUserMongoMapper,
+		AuditMongoMapper: iAuditMongoMapper,
+		TokenManager:     manager,
+	}
+	iClientMongoMapper := client.NewMongoMapper(configConfig)
+	oidcService := service.OIDCService{
+		Config:            configConfig,
+		UserMongoMapper:   iUserMongoMapper,
+		ClientMongoMapper: iClientMongoMapper,
+		PasswordHasher:    hasher,
+		TicketStore:       ticketStore,
+		TokenManager:      manager,
+		Keyring:           keyringKeyring,
+	}
 	stsServerImpl := &adaptor.StsServerImpl{
-		Config:        configConfig,
-		AuthService:   authServiceImpl,
-		CosService:    cosService,
-		FilterService: filterService,
+		Config:         configConfig,
+		AuthService:    authServiceImpl,
+		CosService:     cosService,
+		FilterService:  filterService,
+		TokenService:   tokenService,
+		SessionService: sessionService,
+		AccountService: accountService,
+		OIDCService:    oidcService,
 	}
 	return stsServerImpl, nil
 }